@@ -1,11 +1,11 @@
 package cloudconfig
 
 import (
-	"errors"
 	"log"
 	"net/rpc"
 
 	"github.com/enaml-ops/pluginlib/pcli"
+	"github.com/enaml-ops/pluginlib/perr"
 	"github.com/xchapter7x/lo"
 )
 
@@ -13,40 +13,52 @@ import (
 type Response struct {
 	Bytes  []byte
 	ErrRes string
+	// Err describes the plugin's error.  It is nil in replies from
+	// plugins that only set ErrRes.
+	Err *perr.Error
 }
 
 // RPC - Here is an implementation that talks over RPC
 type RPC struct{ client *rpc.Client }
 
 func (s *RPC) GetMeta() Meta {
-	var resp Meta
-	err := s.client.Call("Plugin.GetMeta", new(interface{}), &resp)
-
+	resp, err := s.GetMetaE()
 	if err != nil {
-		log.Println("[ERROR] GetFlags: ", err)
+		log.Println("[ERROR] GetMeta: ", err)
 	}
 	return resp
 }
 
+// GetMetaE calls the plugin's GetMeta method over RPC.
+// It returns a *perr.TransportError if the plugin could not be reached
+// and a *perr.RemoteError if the plugin failed the call.
+func (s *RPC) GetMetaE() (Meta, error) {
+	var resp Meta
+	err := s.client.Call("Plugin.GetMeta", new(interface{}), &resp)
+	return resp, perr.FromRPC("Plugin.GetMeta", err)
+}
+
 func (s *RPC) GetCloudConfig(args []string) ([]byte, error) {
 	var resp Response
 	lo.G.Debug("calling rpc client getcloudconfig")
 	err := s.client.Call("Plugin.GetCloudConfig", args, &resp)
+	if msg, ok := err.(rpc.ServerError); ok {
+		// older plugins fail the call instead of replying with the error
+		return nil, perr.FromReply(nil, string(msg))
+	}
 	if err != nil {
 		lo.G.Debug("[ERROR] GetCloudConfig:", err)
-		return nil, err
+		return nil, perr.FromRPC("Plugin.GetCloudConfig", err)
 	}
-	if resp.ErrRes != "" {
-		lo.G.Debug("error:", resp.ErrRes)
-		return nil, errors.New(resp.ErrRes)
+	if err = perr.FromReply(resp.Err, resp.ErrRes); err != nil {
+		lo.G.Debug("error:", err)
+		return nil, err
 	}
 	return resp.Bytes, nil
 }
 
 func (s *RPC) GetFlags() []pcli.Flag {
-	var resp []pcli.Flag
-	err := s.client.Call("Plugin.GetFlags", new(interface{}), &resp)
-
+	resp, err := s.GetFlagsE()
 	if err != nil {
 		log.Println("[ERROR] GetFlags: ", err)
 		return nil
@@ -54,6 +66,14 @@ func (s *RPC) GetFlags() []pcli.Flag {
 	return resp
 }
 
+// GetFlagsE calls the plugin's GetFlags method over RPC.
+// It returns the same errors as GetMetaE.
+func (s *RPC) GetFlagsE() ([]pcli.Flag, error) {
+	var resp []pcli.Flag
+	err := s.client.Call("Plugin.GetFlags", new(interface{}), &resp)
+	return resp, perr.FromRPC("Plugin.GetFlags", err)
+}
+
 // RPCServer - Here is the RPC server that GreeterRPC talks to, conforming to
 // the requirements of net/rpc
 type RPCServer struct {
@@ -74,11 +94,12 @@ func (s *RPCServer) GetCloudConfig(args []string, resp *Response) error {
 	var err error
 	resp.Bytes, err = s.Impl.GetCloudConfig(args)
 
+	// the error is sent in the reply rather than returned, since net/rpc
+	// only passes on the message of a returned error
+	resp.Err = perr.Envelope(err)
+	resp.ErrRes = ""
 	if err != nil {
 		resp.ErrRes = err.Error()
-		return err
 	}
-
-	resp.ErrRes = ""
 	return nil
 }
@@ -1,9 +1,13 @@
 package cloudconfig_test
 
 import (
+	"net"
+	"net/rpc"
+
 	"github.com/enaml-ops/pluginlib/cloudconfigv1"
 	"github.com/enaml-ops/pluginlib/cloudconfigv1/cloudconfigv1fakes"
 	"github.com/enaml-ops/pluginlib/pcli"
+	"github.com/enaml-ops/pluginlib/perr"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 )
@@ -42,6 +46,16 @@ var _ = Describe("cloudconfigv1 RPC", func() {
 		Ω(resp).Should(Equal(controlResp))
 	})
 
+	It("sends the plugin's error in the response", func() {
+		d.GetCloudConfigReturns(nil, perr.MissingFlags("az"))
+		rpc := cloudconfig.RPCServer{Impl: d}
+
+		var resp cloudconfig.Response
+		Ω(rpc.GetCloudConfig(nil, &resp)).Should(Succeed())
+		Ω(resp.ErrRes).Should(Equal("missing required flags: --az"))
+		Ω(resp.Err).Should(Equal(perr.MissingFlags("az")))
+	})
+
 	It("Forwards calls to GetFlags", func() {
 		controlFlags := []pcli.Flag{
 			pcli.CreateStringFlag("str", "dummy", ""),
@@ -56,3 +70,19 @@ var _ = Describe("cloudconfigv1 RPC", func() {
 		Ω(resp).Should(Equal(controlFlags))
 	})
 })
+
+var _ = Describe("cloudconfigv1 RPC client", func() {
+	It("returns a transport error when the plugin cannot be reached", func() {
+		serverConn, clientConn := net.Pipe()
+		serverConn.Close()
+		client := rpc.NewClient(clientConn)
+		client.Close()
+		raw, err := cloudconfig.Plugin{}.Client(nil, client)
+		Ω(err).ShouldNot(HaveOccurred())
+		p := raw.(*cloudconfig.RPC)
+
+		_, err = p.GetCloudConfig(nil)
+		Ω(perr.IsTransport(err)).Should(BeTrue())
+		Ω(perr.ExitCode(err)).Should(Equal(perr.ExitUnavailable))
+	})
+})
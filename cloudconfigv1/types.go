@@ -1,6 +1,10 @@
 package cloudconfig
 
-import "github.com/enaml-ops/pluginlib/pcli"
+import (
+	"fmt"
+
+	"github.com/enaml-ops/pluginlib/pcli"
+)
 
 type Meta struct {
 	Name       string
@@ -13,3 +17,39 @@ type Deployer interface {
 	GetFlags() []pcli.Flag
 	GetCloudConfig(args []string) ([]byte, error)
 }
+
+// DeployerE is implemented by Deployers, such as RPC, whose GetMeta and
+// GetFlags calls can fail.  The E variants return the error instead of
+// hiding it.
+type DeployerE interface {
+	GetMetaE() (Meta, error)
+	GetFlagsE() ([]pcli.Flag, error)
+}
+
+// GetMetaE returns d's Meta, using d.GetMetaE when d implements DeployerE.
+// A panic in d.GetMeta is returned as an error.
+func GetMetaE(d Deployer) (meta Meta, err error) {
+	if de, ok := d.(DeployerE); ok {
+		return de.GetMetaE()
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("cloudconfig: GetMeta panicked: %v", r)
+		}
+	}()
+	return d.GetMeta(), nil
+}
+
+// GetFlagsE returns d's flags, using d.GetFlagsE when d implements DeployerE.
+// A panic in d.GetFlags is returned as an error.
+func GetFlagsE(d Deployer) (flags []pcli.Flag, err error) {
+	if de, ok := d.(DeployerE); ok {
+		return de.GetFlagsE()
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("cloudconfig: GetFlags panicked: %v", r)
+		}
+	}()
+	return d.GetFlags(), nil
+}
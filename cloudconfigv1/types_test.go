@@ -0,0 +1,39 @@
+package cloudconfig_test
+
+import (
+	"github.com/enaml-ops/pluginlib/cloudconfigv1"
+	"github.com/enaml-ops/pluginlib/cloudconfigv1/cloudconfigv1fakes"
+	"github.com/enaml-ops/pluginlib/pcli"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("GetMetaE and GetFlagsE", func() {
+	var d *cloudconfigv1fakes.FakeDeployer
+
+	BeforeEach(func() {
+		d = new(cloudconfigv1fakes.FakeDeployer)
+	})
+
+	It("returns the results of a Deployer without E methods", func() {
+		d.GetMetaReturns(cloudconfig.Meta{Name: "fakemeta"})
+		d.GetFlagsReturns([]pcli.Flag{pcli.CreateBoolFlag("b", "dummy")})
+
+		meta, err := cloudconfig.GetMetaE(d)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(meta.Name).Should(Equal("fakemeta"))
+		flags, err := cloudconfig.GetFlagsE(d)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(flags).Should(HaveLen(1))
+	})
+
+	It("returns panics as errors", func() {
+		d.GetMetaStub = func() cloudconfig.Meta { panic("boom") }
+		d.GetFlagsStub = func() []pcli.Flag { panic("boom") }
+
+		_, err := cloudconfig.GetMetaE(d)
+		Ω(err).Should(MatchError(ContainSubstring("boom")))
+		_, err = cloudconfig.GetFlagsE(d)
+		Ω(err).Should(MatchError(ContainSubstring("boom")))
+	})
+})
@@ -0,0 +1,120 @@
+package cred
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Write is a credential write recorded by a Recorder.
+type Write struct {
+	Path  string
+	Key   string
+	Value string
+}
+
+// Recorder is a Store that records writes instead of making them, so that
+// a plugin can be asked what it would generate without changing the
+// store.  Reads see the recorded writes on top of the wrapped store.
+type Recorder struct {
+	store Store
+
+	mu      sync.Mutex
+	writes  []Write
+	written map[string]map[string]string
+}
+
+// NewRecorder creates a Recorder that reads from s, which may be nil.
+func NewRecorder(s Store) *Recorder {
+	return &Recorder{
+		store:   s,
+		written: make(map[string]map[string]string),
+	}
+}
+
+// Get gets a single value from the specified path, returning the value
+// recorded for it if there is one.
+func (r *Recorder) Get(path, key string) (string, error) {
+	r.mu.Lock()
+	val, ok := r.written[path][key]
+	r.mu.Unlock()
+	if ok {
+		return val, nil
+	}
+	if r.store == nil {
+		return "", fmt.Errorf("cred: %s not found in %s", key, path)
+	}
+	return r.store.Get(path, key)
+}
+
+// GetBulk gets all key/value pairs from the specified path, including
+// those recorded for it.
+func (r *Recorder) GetBulk(path string) (map[string]string, error) {
+	r.mu.Lock()
+	written, ok := r.written[path]
+	res := make(map[string]string, len(written))
+	for k, v := range written {
+		res[k] = v
+	}
+	r.mu.Unlock()
+
+	if r.store == nil {
+		if !ok {
+			return nil, fmt.Errorf("cred: %s not found", path)
+		}
+		return res, nil
+	}
+	stored, err := r.store.GetBulk(path)
+	if err != nil {
+		if ok {
+			return res, nil
+		}
+		return nil, err
+	}
+	for k, v := range stored {
+		if _, ok := res[k]; !ok {
+			res[k] = v
+		}
+	}
+	return res, nil
+}
+
+// Post records a single value for the specified path.
+func (r *Recorder) Post(path, key, value string) error {
+	r.mu.Lock()
+	r.record(path, key, value)
+	r.mu.Unlock()
+	return nil
+}
+
+// PostBulk records all key/value pairs for the specified path,
+// in order of key.
+func (r *Recorder) PostBulk(path string, values map[string]string) error {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	r.mu.Lock()
+	for _, k := range keys {
+		r.record(path, k, values[k])
+	}
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *Recorder) record(path, key, value string) {
+	r.writes = append(r.writes, Write{Path: path, Key: key, Value: value})
+	if r.written[path] == nil {
+		r.written[path] = make(map[string]string)
+	}
+	r.written[path][key] = value
+}
+
+// Writes returns the writes recorded so far, in the order they were made.
+func (r *Recorder) Writes() []Write {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Write(nil), r.writes...)
+}
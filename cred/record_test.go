@@ -0,0 +1,73 @@
+package cred_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/enaml-ops/pluginlib/cred"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("recording cred store", func() {
+	var (
+		dir   string
+		store cred.Store
+		rec   *cred.Recorder
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "cred-record")
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(ioutil.WriteFile(filepath.Join(dir, "p-mysql"), []byte(`{"admin": "stored"}`), 0644)).Should(Succeed())
+		store = cred.NewFileStore(dir)
+		rec = cred.NewRecorder(store)
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("reads from the wrapped store", func() {
+		Ω(rec.Get("p-mysql", "admin")).Should(Equal("stored"))
+		Ω(rec.GetBulk("p-mysql")).Should(Equal(map[string]string{"admin": "stored"}))
+		_, err := rec.Get("p-mysql", "missing")
+		Ω(err).Should(HaveOccurred())
+	})
+
+	It("records writes without making them", func() {
+		Ω(rec.Post("p-mysql", "admin", "generated")).Should(Succeed())
+		Ω(rec.PostBulk("p-redis", map[string]string{"b": "2", "a": "1"})).Should(Succeed())
+
+		Ω(rec.Writes()).Should(Equal([]cred.Write{
+			{Path: "p-mysql", Key: "admin", Value: "generated"},
+			{Path: "p-redis", Key: "a", Value: "1"},
+			{Path: "p-redis", Key: "b", Value: "2"},
+		}))
+		Ω(store.Get("p-mysql", "admin")).Should(Equal("stored"))
+		_, err := store.GetBulk("p-redis")
+		Ω(err).Should(HaveOccurred())
+	})
+
+	It("reads back recorded writes", func() {
+		Ω(rec.Post("p-mysql", "password", "generated")).Should(Succeed())
+		Ω(rec.PostBulk("p-redis", map[string]string{"a": "1"})).Should(Succeed())
+
+		Ω(rec.Get("p-mysql", "password")).Should(Equal("generated"))
+		Ω(rec.GetBulk("p-mysql")).Should(Equal(map[string]string{"admin": "stored", "password": "generated"}))
+		Ω(rec.GetBulk("p-redis")).Should(Equal(map[string]string{"a": "1"}))
+	})
+
+	It("works without a wrapped store", func() {
+		rec = cred.NewRecorder(nil)
+		_, err := rec.Get("p-mysql", "admin")
+		Ω(err).Should(HaveOccurred())
+		_, err = rec.GetBulk("p-mysql")
+		Ω(err).Should(HaveOccurred())
+
+		Ω(rec.Post("p-mysql", "admin", "generated")).Should(Succeed())
+		Ω(rec.GetBulk("p-mysql")).Should(Equal(map[string]string{"admin": "generated"}))
+	})
+})
@@ -0,0 +1,88 @@
+package cred
+
+import "net/rpc"
+
+type (
+	// GetArgs contains the args for a Get call.
+	GetArgs struct {
+		Path string
+		Key  string
+	}
+	// PostArgs contains the args for a Post call.
+	PostArgs struct {
+		Path  string
+		Key   string
+		Value string
+	}
+	// PostBulkArgs contains the args for a PostBulk call.
+	PostBulkArgs struct {
+		Path   string
+		Values map[string]string
+	}
+)
+
+// RPC is an implementation of Store that talks over RPC to a store
+// in another process, such as a plugin host.
+type RPC struct {
+	client *rpc.Client
+}
+
+// NewRPC creates a Store that forwards each call over client
+// to an RPCServer registered under the name "Plugin".
+func NewRPC(client *rpc.Client) *RPC {
+	return &RPC{client: client}
+}
+
+// Get calls the remote store's Get method.
+func (s *RPC) Get(path, key string) (string, error) {
+	var resp string
+	err := s.client.Call("Plugin.Get", GetArgs{Path: path, Key: key}, &resp)
+	return resp, err
+}
+
+// GetBulk calls the remote store's GetBulk method.
+func (s *RPC) GetBulk(path string) (map[string]string, error) {
+	var resp map[string]string
+	err := s.client.Call("Plugin.GetBulk", path, &resp)
+	return resp, err
+}
+
+// Post calls the remote store's Post method.
+func (s *RPC) Post(path, key, value string) error {
+	return s.client.Call("Plugin.Post", PostArgs{Path: path, Key: key, Value: value}, new(interface{}))
+}
+
+// PostBulk calls the remote store's PostBulk method.
+func (s *RPC) PostBulk(path string, values map[string]string) error {
+	return s.client.Call("Plugin.PostBulk", PostBulkArgs{Path: path, Values: values}, new(interface{}))
+}
+
+// RPCServer serves a Store to RPC clients.
+// It conforms to the requirements of net/rpc.
+type RPCServer struct {
+	Impl Store
+}
+
+// Get forwards the RPC request to the store's Get method.
+func (s *RPCServer) Get(args GetArgs, resp *string) error {
+	var err error
+	*resp, err = s.Impl.Get(args.Path, args.Key)
+	return err
+}
+
+// GetBulk forwards the RPC request to the store's GetBulk method.
+func (s *RPCServer) GetBulk(path string, resp *map[string]string) error {
+	var err error
+	*resp, err = s.Impl.GetBulk(path)
+	return err
+}
+
+// Post forwards the RPC request to the store's Post method.
+func (s *RPCServer) Post(args PostArgs, resp *interface{}) error {
+	return s.Impl.Post(args.Path, args.Key, args.Value)
+}
+
+// PostBulk forwards the RPC request to the store's PostBulk method.
+func (s *RPCServer) PostBulk(args PostBulkArgs, resp *interface{}) error {
+	return s.Impl.PostBulk(args.Path, args.Values)
+}
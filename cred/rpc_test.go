@@ -0,0 +1,58 @@
+package cred_test
+
+import (
+	"io/ioutil"
+	"net"
+	"net/rpc"
+	"os"
+	"path/filepath"
+
+	"github.com/enaml-ops/pluginlib/cred"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("cred store over RPC", func() {
+	var (
+		dir    string
+		client *rpc.Client
+		cs     cred.Store
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "cred-rpc")
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(ioutil.WriteFile(filepath.Join(dir, "secrets"), []byte(`{"user": "admin"}`), 0644)).Should(Succeed())
+
+		server := rpc.NewServer()
+		Ω(server.RegisterName("Plugin", &cred.RPCServer{Impl: cred.NewFileStore(dir)})).Should(Succeed())
+		serverConn, clientConn := net.Pipe()
+		go server.ServeConn(serverConn)
+		client = rpc.NewClient(clientConn)
+		cs = cred.NewRPC(client)
+	})
+
+	AfterEach(func() {
+		client.Close()
+		os.RemoveAll(dir)
+	})
+
+	It("reads values from the remote store", func() {
+		Ω(cs.Get("secrets", "user")).Should(Equal("admin"))
+		Ω(cs.GetBulk("secrets")).Should(Equal(map[string]string{"user": "admin"}))
+	})
+
+	It("writes values to the remote store", func() {
+		Ω(cs.Post("secrets", "pass", "hunter2")).Should(Succeed())
+		Ω(cred.NewFileStore(dir).Get("secrets", "pass")).Should(Equal("hunter2"))
+
+		Ω(cs.PostBulk("secrets", map[string]string{"user": "root"})).Should(Succeed())
+		Ω(cred.NewFileStore(dir).GetBulk("secrets")).Should(Equal(map[string]string{"user": "root"}))
+	})
+
+	It("returns errors from the remote store", func() {
+		_, err := cs.Get("secrets", "missing")
+		Ω(err).Should(MatchError(ContainSubstring("missing not found")))
+	})
+})
@@ -0,0 +1,442 @@
+// Package mdiff computes semantic differences between BOSH deployment
+// manifests, such as the output of a product plugin before and after an
+// upgrade.
+//
+// Manifests are compared as YAML documents rather than as text.  Lists of
+// named items, such as instance groups, jobs and releases, are matched by
+// name, so reordering them is not a change.  Changes are reported with
+// the paths used by BOSH ops files, for example
+// /instance_groups/name=web/jobs/name=atc/properties/port.
+package mdiff
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/enaml-ops/pluginlib/cred"
+	"gopkg.in/yaml.v2"
+)
+
+// Redacted replaces values that contain secrets.
+const Redacted = "<redacted>"
+
+// ChangeType is the kind of a Change.
+type ChangeType string
+
+const (
+	Added   ChangeType = "added"
+	Removed ChangeType = "removed"
+	Changed ChangeType = "changed"
+)
+
+// Change is a difference between two manifests.
+type Change struct {
+	Type ChangeType `json:"type"`
+	Path string     `json:"path"`
+	// Old is the value in the old manifest, or nil if it was added.
+	Old interface{} `json:"old,omitempty"`
+	// New is the value in the new manifest, or nil if it was removed.
+	New interface{} `json:"new,omitempty"`
+	// Redacted is true if secrets were removed from Old or New.
+	Redacted bool `json:"redacted,omitempty"`
+}
+
+// Options controls how manifests are compared.
+type Options struct {
+	// Secrets are values, such as those read from a cred store, that must
+	// not appear in the diff.  Any value or name in a path that contains
+	// one is replaced by Redacted, and map keys by a numbered <redacted-N>.
+	Secrets []string
+}
+
+// Diff is the list of changes between two manifests.
+type Diff struct {
+	Changes []Change `json:"changes"`
+}
+
+// Compare returns the changes needed to turn the old manifest into the
+// new one.  Either may be empty.
+func Compare(old, new []byte, opts Options) (*Diff, error) {
+	o, err := parse(old)
+	if err != nil {
+		return nil, fmt.Errorf("mdiff: parsing old manifest: %v", err)
+	}
+	n, err := parse(new)
+	if err != nil {
+		return nil, fmt.Errorf("mdiff: parsing new manifest: %v", err)
+	}
+	// an empty manifest is an empty document
+	if o == nil {
+		o = map[string]interface{}{}
+	}
+	if n == nil {
+		n = map[string]interface{}{}
+	}
+	c := comparer{secrets: opts.Secrets}
+	c.compare("", o, n)
+	return &Diff{Changes: c.changes}, nil
+}
+
+// Secrets returns every value stored in the cred store at the given
+// paths, for use in Options.Secrets.
+func Secrets(store cred.Store, paths ...string) ([]string, error) {
+	var res []string
+	for _, path := range paths {
+		values, err := store.GetBulk(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range values {
+			res = append(res, v)
+		}
+	}
+	return res, nil
+}
+
+// WriteSecrets returns the values of writes, such as those recorded by a
+// dry run, for use in Options.Secrets.
+func WriteSecrets(writes []cred.Write) []string {
+	var res []string
+	for _, w := range writes {
+		res = append(res, w.Value)
+	}
+	return res
+}
+
+// Empty reports whether the manifests are the same.
+func (d *Diff) Empty() bool {
+	return len(d.Changes) == 0
+}
+
+// JSON returns the diff as JSON.
+func (d *Diff) JSON() ([]byte, error) {
+	return json.Marshal(d)
+}
+
+// String returns the diff as text.
+func (d *Diff) String() string {
+	var buf bytes.Buffer
+	d.WriteText(&buf)
+	return buf.String()
+}
+
+// WriteText writes the diff as text, one change per line.  Lines start
+// with "+" for added values, "-" for removed ones and "~" for changed
+// ones.  Maps and lists are written as indented YAML after the line.
+func (d *Diff) WriteText(w io.Writer) error {
+	for _, c := range d.Changes {
+		var err error
+		switch c.Type {
+		case Added:
+			err = writeValue(w, "+ "+c.Path, c.New, "    ")
+		case Removed:
+			err = writeValue(w, "- "+c.Path, c.Old, "    ")
+		default:
+			if isScalar(c.Old) && isScalar(c.New) {
+				_, err = fmt.Fprintf(w, "~ %s: %s -> %s\n", c.Path, scalar(c.Old), scalar(c.New))
+				break
+			}
+			if _, err = fmt.Fprintf(w, "~ %s:\n", c.Path); err != nil {
+				break
+			}
+			if err = writeValue(w, "    was", c.Old, "        "); err == nil {
+				err = writeValue(w, "    now", c.New, "        ")
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeValue writes v after prefix, as YAML indented by indent if v is a
+// map or a list.
+func writeValue(w io.Writer, prefix string, v interface{}, indent string) error {
+	if isScalar(v) {
+		_, err := fmt.Fprintf(w, "%s: %s\n", prefix, scalar(v))
+		return err
+	}
+	b, err := yaml.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if _, err = fmt.Fprintf(w, "%s:\n", prefix); err != nil {
+		return err
+	}
+	for _, line := range strings.Split(strings.TrimRight(string(b), "\n"), "\n") {
+		if _, err = fmt.Fprintf(w, "%s%s\n", indent, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func isScalar(v interface{}) bool {
+	switch v.(type) {
+	case map[string]interface{}, []interface{}:
+		return false
+	}
+	return true
+}
+
+func scalar(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		if v == Redacted {
+			return v
+		}
+		return strconv.Quote(v)
+	}
+	return fmt.Sprint(v)
+}
+
+type comparer struct {
+	secrets []string
+	changes []Change
+}
+
+func (c *comparer) compare(path string, old, new interface{}) {
+	switch o := old.(type) {
+	case map[string]interface{}:
+		if n, ok := new.(map[string]interface{}); ok {
+			c.compareMaps(path, o, n)
+			return
+		}
+	case []interface{}:
+		if n, ok := new.([]interface{}); ok {
+			c.compareLists(path, o, n)
+			return
+		}
+	}
+	if !reflect.DeepEqual(old, new) {
+		c.add(Changed, path, old, new)
+	}
+}
+
+func (c *comparer) compareMaps(path string, old, new map[string]interface{}) {
+	keys := make([]string, 0, len(old)+len(new))
+	for k := range old {
+		keys = append(keys, k)
+	}
+	for k := range new {
+		if _, ok := old[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		o, inOld := old[k]
+		n, inNew := new[k]
+		p := path + "/" + k
+		switch {
+		case !inOld:
+			c.add(Added, p, nil, n)
+		case !inNew:
+			c.add(Removed, p, o, nil)
+		default:
+			c.compare(p, o, n)
+		}
+	}
+}
+
+// compareLists matches the items of lists of named maps by name, and
+// the items of other lists by position.
+func (c *comparer) compareLists(path string, old, new []interface{}) {
+	key := nameKey(old, new)
+	if key == "" {
+		for i := 0; i < len(old) || i < len(new); i++ {
+			p := path + "/" + strconv.Itoa(i)
+			switch {
+			case i >= len(old):
+				c.add(Added, p, nil, new[i])
+			case i >= len(new):
+				c.add(Removed, p, old[i], nil)
+			default:
+				c.compare(p, old[i], new[i])
+			}
+		}
+		return
+	}
+
+	newItems := make(map[string]interface{}, len(new))
+	for _, item := range new {
+		newItems[name(item, key)] = item
+	}
+	oldNames := make(map[string]bool, len(old))
+	for _, item := range old {
+		nm := name(item, key)
+		oldNames[nm] = true
+		p := path + "/" + key + "=" + nm
+		if n, ok := newItems[nm]; ok {
+			c.compare(p, item, n)
+		} else {
+			c.add(Removed, p, item, nil)
+		}
+	}
+	for _, item := range new {
+		nm := name(item, key)
+		if !oldNames[nm] {
+			c.add(Added, path+"/"+key+"="+nm, nil, item)
+		}
+	}
+}
+
+// nameKey returns the key, "name" or "alias", that identifies every item
+// in both lists, or "" if there is none.
+func nameKey(old, new []interface{}) string {
+	for _, key := range []string{"name", "alias"} {
+		if named(old, key) && named(new, key) {
+			return key
+		}
+	}
+	return ""
+}
+
+// named reports whether every item in list is a map with a distinct
+// string value for key.
+func named(list []interface{}, key string) bool {
+	seen := make(map[string]bool, len(list))
+	for _, item := range list {
+		nm := name(item, key)
+		if nm == "" || seen[nm] {
+			return false
+		}
+		seen[nm] = true
+	}
+	return true
+}
+
+func name(item interface{}, key string) string {
+	m, ok := item.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	s, _ := m[key].(string)
+	return s
+}
+
+func (c *comparer) add(typ ChangeType, path string, old, new interface{}) {
+	if path == "" {
+		path = "/"
+	}
+	var rp, ro, rn bool
+	ch := Change{Type: typ}
+	ch.Path, rp = c.redactPath(path)
+	ch.Old, ro = c.redact(old)
+	ch.New, rn = c.redact(new)
+	ch.Redacted = rp || ro || rn
+	c.changes = append(c.changes, ch)
+}
+
+// secret reports whether s contains a secret.
+func (c *comparer) secret(s string) bool {
+	for _, secret := range c.secrets {
+		if secret != "" && strings.Contains(s, secret) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactPath replaces the parts of path that contain a secret.  For
+// items matched by name only the name is replaced, as in
+// /jobs/name=<redacted>.
+func (c *comparer) redactPath(path string) (string, bool) {
+	segments := strings.Split(path, "/")
+	redacted := false
+	for i, seg := range segments {
+		if !c.secret(seg) {
+			continue
+		}
+		redacted = true
+		if j := strings.Index(seg, "="); j > 0 && !c.secret(seg[:j]) {
+			segments[i] = seg[:j+1] + Redacted
+		} else {
+			segments[i] = Redacted
+		}
+	}
+	return strings.Join(segments, "/"), redacted
+}
+
+// redact returns a copy of v with every scalar that contains a secret
+// replaced by Redacted.  Map keys that contain one are numbered, as in
+// <redacted-1>, so that they stay distinct.  Numbers and booleans are
+// matched by their YAML text, so an unquoted numeric secret is also found.
+func (c *comparer) redact(v interface{}) (interface{}, bool) {
+	switch v := v.(type) {
+	case nil:
+		return nil, false
+	case string:
+		if c.secret(v) {
+			return Redacted, true
+		}
+		return v, false
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		res := make(map[string]interface{}, len(v))
+		redacted := false
+		n := 0
+		for _, k := range keys {
+			val, r := c.redact(v[k])
+			redacted = redacted || r
+			if c.secret(k) {
+				n++
+				k, redacted = fmt.Sprintf("<redacted-%d>", n), true
+			}
+			res[k] = val
+		}
+		return res, redacted
+	case []interface{}:
+		res := make([]interface{}, len(v))
+		redacted := false
+		for i, val := range v {
+			var r bool
+			res[i], r = c.redact(val)
+			redacted = redacted || r
+		}
+		return res, redacted
+	}
+	if c.secret(fmt.Sprint(v)) {
+		return Redacted, true
+	}
+	return v, false
+}
+
+// parse decodes a YAML document into maps with string keys.
+func parse(b []byte) (interface{}, error) {
+	var v interface{}
+	if err := yaml.Unmarshal(b, &v); err != nil {
+		return nil, err
+	}
+	return stringKeys(v), nil
+}
+
+func stringKeys(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		res := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			res[fmt.Sprint(k)] = stringKeys(val)
+		}
+		return res
+	case []interface{}:
+		for i, val := range v {
+			v[i] = stringKeys(val)
+		}
+		return v
+	}
+	return v
+}
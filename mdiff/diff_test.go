@@ -0,0 +1,277 @@
+package mdiff_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/enaml-ops/pluginlib/cred"
+	"github.com/enaml-ops/pluginlib/mdiff"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+const deployed = `name: concourse
+releases:
+- name: concourse
+  version: 2.4.0
+- name: garden-runc
+  version: 1.0.0
+stemcells:
+- alias: trusty
+  os: ubuntu-trusty
+  version: "3263.8"
+instance_groups:
+- name: web
+  instances: 1
+  jobs:
+  - name: atc
+    release: concourse
+    properties:
+      basic_auth_password: s3cr3t
+      bind_port: 8080
+  - name: tsa
+    release: concourse
+- name: worker
+  instances: 2
+  azs: [z1, z2]
+  jobs:
+  - name: groundcrew
+    release: concourse
+`
+
+var _ = Describe("Compare", func() {
+	It("finds no changes in identical manifests", func() {
+		d, err := mdiff.Compare([]byte(deployed), []byte(deployed), mdiff.Options{})
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(d.Empty()).Should(BeTrue())
+		Ω(d.String()).Should(BeEmpty())
+	})
+
+	It("matches named items regardless of their order", func() {
+		reordered := `name: concourse
+releases:
+- name: garden-runc
+  version: 1.0.0
+- name: concourse
+  version: 2.4.0
+stemcells:
+- alias: trusty
+  os: ubuntu-trusty
+  version: "3263.8"
+instance_groups:
+- name: worker
+  instances: 2
+  azs: [z1, z2]
+  jobs:
+  - name: groundcrew
+    release: concourse
+- name: web
+  instances: 1
+  jobs:
+  - name: tsa
+    release: concourse
+  - name: atc
+    release: concourse
+    properties:
+      bind_port: 8080
+      basic_auth_password: s3cr3t
+`
+		d, err := mdiff.Compare([]byte(deployed), []byte(reordered), mdiff.Options{})
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(d.Changes).Should(BeEmpty())
+	})
+
+	It("reports changes by path", func() {
+		upgraded := `name: concourse
+releases:
+- name: concourse
+  version: 2.5.0
+- name: garden-runc
+  version: 1.0.0
+stemcells:
+- alias: trusty
+  os: ubuntu-trusty
+  version: "3263.8"
+instance_groups:
+- name: web
+  instances: 2
+  jobs:
+  - name: atc
+    release: concourse
+    properties:
+      basic_auth_password: s3cr3t
+      bind_port: 8080
+- name: worker
+  instances: 2
+  azs: [z1, z3]
+  jobs:
+  - name: groundcrew
+    release: concourse
+  - name: baggageclaim
+    release: concourse
+`
+		d, err := mdiff.Compare([]byte(deployed), []byte(upgraded), mdiff.Options{})
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(d.Changes).Should(Equal([]mdiff.Change{
+			{Type: mdiff.Changed, Path: "/instance_groups/name=web/instances", Old: 1, New: 2},
+			{Type: mdiff.Removed, Path: "/instance_groups/name=web/jobs/name=tsa", Old: map[string]interface{}{"name": "tsa", "release": "concourse"}},
+			{Type: mdiff.Changed, Path: "/instance_groups/name=worker/azs/1", Old: "z2", New: "z3"},
+			{Type: mdiff.Added, Path: "/instance_groups/name=worker/jobs/name=baggageclaim", New: map[string]interface{}{"name": "baggageclaim", "release": "concourse"}},
+			{Type: mdiff.Changed, Path: "/releases/name=concourse/version", Old: "2.4.0", New: "2.5.0"},
+		}))
+
+		Ω(d.String()).Should(Equal(`~ /instance_groups/name=web/instances: 1 -> 2
+- /instance_groups/name=web/jobs/name=tsa:
+    name: tsa
+    release: concourse
+~ /instance_groups/name=worker/azs/1: "z2" -> "z3"
++ /instance_groups/name=worker/jobs/name=baggageclaim:
+    name: baggageclaim
+    release: concourse
+~ /releases/name=concourse/version: "2.4.0" -> "2.5.0"
+`))
+	})
+
+	It("compares against an empty manifest", func() {
+		d, err := mdiff.Compare(nil, []byte("name: concourse\n"), mdiff.Options{})
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(d.Changes).Should(Equal([]mdiff.Change{{Type: mdiff.Added, Path: "/name", New: "concourse"}}))
+	})
+
+	It("shows values that change shape", func() {
+		d, err := mdiff.Compare([]byte("properties: {a: 1}\n"), []byte("properties: [a]\n"), mdiff.Options{})
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(d.String()).Should(Equal(`~ /properties:
+    was:
+        a: 1
+    now:
+        - a
+`))
+	})
+
+	It("returns an error for invalid YAML", func() {
+		_, err := mdiff.Compare([]byte("name: [concourse"), []byte(deployed), mdiff.Options{})
+		Ω(err).Should(MatchError(ContainSubstring("old manifest")))
+		_, err = mdiff.Compare([]byte(deployed), []byte("name: [concourse"), mdiff.Options{})
+		Ω(err).Should(MatchError(ContainSubstring("new manifest")))
+	})
+
+	Context("when the manifests contain secrets", func() {
+		rotated := []byte(`name: concourse
+instance_groups:
+- name: web
+  jobs:
+  - name: atc
+    properties:
+      basic_auth_password: n3w-s3cr3t
+      postgresql_database: postgres://atc:n3w-s3cr3t@db/atc
+`)
+		old := []byte(`name: concourse
+instance_groups:
+- name: web
+  jobs:
+  - name: atc
+    properties:
+      basic_auth_password: s3cr3t
+`)
+
+		It("redacts them", func() {
+			d, err := mdiff.Compare(old, rotated, mdiff.Options{Secrets: []string{"s3cr3t", "n3w-s3cr3t"}})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(d.Changes).Should(Equal([]mdiff.Change{
+				{Type: mdiff.Changed, Path: "/instance_groups/name=web/jobs/name=atc/properties/basic_auth_password", Old: mdiff.Redacted, New: mdiff.Redacted, Redacted: true},
+				{Type: mdiff.Added, Path: "/instance_groups/name=web/jobs/name=atc/properties/postgresql_database", New: mdiff.Redacted, Redacted: true},
+			}))
+			Ω(d.String()).ShouldNot(ContainSubstring("s3cr3t"))
+			b, err := d.JSON()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(string(b)).ShouldNot(ContainSubstring("s3cr3t"))
+		})
+
+		It("redacts secrets inside added maps", func() {
+			d, err := mdiff.Compare([]byte("name: concourse\n"), old, mdiff.Options{Secrets: []string{"s3cr3t"}})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(d.Changes).Should(HaveLen(1))
+			Ω(d.Changes[0].Redacted).Should(BeTrue())
+			Ω(d.String()).Should(ContainSubstring("basic_auth_password: <redacted>"))
+			Ω(d.String()).ShouldNot(ContainSubstring("s3cr3t"))
+		})
+
+		It("redacts numbers and booleans", func() {
+			d, err := mdiff.Compare([]byte("pin: 111111\n"), []byte("pin: 424242\n"), mdiff.Options{Secrets: []string{"111111", "424242"}})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(d.Changes).Should(Equal([]mdiff.Change{
+				{Type: mdiff.Changed, Path: "/pin", Old: mdiff.Redacted, New: mdiff.Redacted, Redacted: true},
+			}))
+			Ω(d.String()).Should(Equal("~ /pin: <redacted> -> <redacted>\n"))
+		})
+
+		It("redacts map keys", func() {
+			d, err := mdiff.Compare([]byte("users: {}\n"), []byte("users:\n  s3cr3t-token: admin\n"), mdiff.Options{Secrets: []string{"s3cr3t"}})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(d.Changes).Should(Equal([]mdiff.Change{
+				{Type: mdiff.Added, Path: "/users/<redacted>", New: "admin", Redacted: true},
+			}))
+
+			d, err = mdiff.Compare([]byte("name: a\n"), []byte("users:\n  s3cr3t-token: admin\n"), mdiff.Options{Secrets: []string{"s3cr3t"}})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(d.String()).ShouldNot(ContainSubstring("s3cr3t"))
+			Ω(d.String()).Should(ContainSubstring("<redacted-1>: admin"))
+		})
+
+		It("keeps redacted map keys apart", func() {
+			d, err := mdiff.Compare([]byte("name: a\n"), []byte("users:\n  alice-s3cret: x\n  bob-t0ken: z\n"), mdiff.Options{Secrets: []string{"s3cret", "t0ken"}})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(d.Changes).Should(ContainElement(mdiff.Change{
+				Type:     mdiff.Added,
+				Path:     "/users",
+				New:      map[string]interface{}{"<redacted-1>": "x", "<redacted-2>": "z"},
+				Redacted: true,
+			}))
+		})
+
+		It("redacts names in paths", func() {
+			d, err := mdiff.Compare(
+				[]byte("users:\n- name: s3cr3t\n  groups: [a]\n"),
+				[]byte("users:\n- name: s3cr3t\n  groups: [b]\n"),
+				mdiff.Options{Secrets: []string{"s3cr3t"}})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(d.Changes).Should(Equal([]mdiff.Change{
+				{Type: mdiff.Changed, Path: "/users/name=<redacted>/groups/0", Old: "a", New: "b", Redacted: true},
+			}))
+		})
+
+		It("reads them from a cred store", func() {
+			dir, err := ioutil.TempDir("", "mdiff")
+			Ω(err).ShouldNot(HaveOccurred())
+			defer os.RemoveAll(dir)
+			Ω(ioutil.WriteFile(filepath.Join(dir, "concourse"), []byte(`{"password": "s3cr3t"}`), 0644)).Should(Succeed())
+
+			secrets, err := mdiff.Secrets(cred.NewFileStore(dir), "concourse")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(secrets).Should(Equal([]string{"s3cr3t"}))
+			_, err = mdiff.Secrets(cred.NewFileStore(dir), "missing")
+			Ω(err).Should(HaveOccurred())
+
+			Ω(mdiff.WriteSecrets([]cred.Write{{Path: "concourse", Key: "password", Value: "n3w-s3cr3t"}})).Should(Equal([]string{"n3w-s3cr3t"}))
+		})
+	})
+
+	It("encodes the diff as JSON", func() {
+		d, err := mdiff.Compare([]byte("name: a\nstale: true\n"), []byte("name: b\n"), mdiff.Options{})
+		Ω(err).ShouldNot(HaveOccurred())
+		b, err := d.JSON()
+		Ω(err).ShouldNot(HaveOccurred())
+
+		var decoded map[string]interface{}
+		Ω(json.Unmarshal(b, &decoded)).Should(Succeed())
+		Ω(decoded).Should(Equal(map[string]interface{}{
+			"changes": []interface{}{
+				map[string]interface{}{"type": "changed", "path": "/name", "old": "a", "new": "b"},
+				map[string]interface{}{"type": "removed", "path": "/stale", "old": true},
+			},
+		}))
+	})
+})
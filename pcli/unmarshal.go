@@ -8,6 +8,7 @@ import (
 	"strings"
 	"unicode"
 
+	"github.com/enaml-ops/pluginlib/perr"
 	cli "gopkg.in/urfave/cli.v2"
 )
 
@@ -26,7 +27,7 @@ const omgTagName = "omg"
 //
 // By default, UnmarshalFlags assumes that all fields in obj that
 // are not explicitly skipped over with `omg:"-"` are required flags.
-// It will return an error if a required flag is missing.
+// It will return a *perr.Error naming the required flags that are missing.
 //
 // If a flag is not required and you don't want an error if it's
 // missing, the flag can be annotated with `omg:"flag-name,optional"`.
@@ -46,7 +47,11 @@ func UnmarshalFlags(obj interface{}, c *cli.Context) error {
 	missingFlags = append(missingFlags, unmarshal(structVal, typ, c)...)
 
 	if len(missingFlags) > 0 {
-		return fmt.Errorf("unmarshal: missing flags %v", missingFlags)
+		return &perr.Error{
+			Code:    perr.CodeMissingFlags,
+			Message: fmt.Sprintf("unmarshal: missing flags %v", missingFlags),
+			Flags:   missingFlags,
+		}
 	}
 	return nil
 }
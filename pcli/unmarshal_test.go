@@ -5,6 +5,7 @@ import (
 	. "github.com/onsi/gomega"
 
 	"github.com/enaml-ops/pluginlib/pcli"
+	"github.com/enaml-ops/pluginlib/perr"
 	"github.com/enaml-ops/pluginlib/pluginutil"
 
 	cli "gopkg.in/urfave/cli.v2"
@@ -242,7 +243,10 @@ var _ = Describe("Unmarshal flags", func() {
 				FloatFlag       float64
 			}
 			t := FlagTest{}
-			Ω(pcli.UnmarshalFlags(&t, context)).ShouldNot(Succeed())
+			err := pcli.UnmarshalFlags(&t, context)
+			Ω(err).Should(HaveOccurred())
+			Ω(perr.CodeOf(err)).Should(Equal(perr.CodeMissingFlags))
+			Ω(perr.FlagsOf(err)).Should(ConsistOf("string-flag", "int-flag"))
 		})
 
 		Context("when the context is missing required slice flags", func() {
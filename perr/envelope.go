@@ -0,0 +1,204 @@
+package perr
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Code classifies an error returned by a plugin.
+type Code string
+
+const (
+	// CodeUnknown is used for errors that were not given a code, including
+	// all errors from plugins built before codes existed.
+	CodeUnknown Code = "unknown"
+	// CodeMissingFlags means required flags were not given.
+	CodeMissingFlags Code = "missing_flags"
+	// CodeInvalidFlags means flags were given invalid values.
+	CodeInvalidFlags Code = "invalid_flags"
+	// CodeCredStore means the plugin could not read or write the cred store.
+	CodeCredStore Code = "cred_store"
+	// CodeInternal means the plugin failed because of a bug.
+	CodeInternal Code = "internal"
+)
+
+// Exit codes returned by ExitCode, taken from sysexits(3).
+const (
+	ExitFailure     = 1
+	ExitUsage       = 64
+	ExitUnavailable = 69
+	ExitSoftware    = 70
+	ExitIOErr       = 74
+)
+
+// Error is the error envelope a plugin sends back to the host.  Plugins
+// return one of these from their Deployer methods to tell the host what
+// went wrong; any other error reaches the host with CodeUnknown.
+type Error struct {
+	Code    Code
+	Message string
+	// Flags names the flags involved, without leading dashes.
+	Flags []string
+	// Retryable is true if the call can safely be made again.
+	Retryable bool
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// New returns an *Error with the given code and a formatted message.
+func New(code Code, format string, args ...interface{}) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// MissingFlags returns an *Error reporting that the named flags are required.
+func MissingFlags(flags ...string) *Error {
+	return &Error{
+		Code:    CodeMissingFlags,
+		Message: fmt.Sprintf("missing required flags: %s", dashed(flags)),
+		Flags:   flags,
+	}
+}
+
+// InvalidFlags returns an *Error reporting that the named flags have
+// invalid values, with a formatted explanation.
+func InvalidFlags(flags []string, format string, args ...interface{}) *Error {
+	return &Error{
+		Code:    CodeInvalidFlags,
+		Message: fmt.Sprintf("invalid %s: %s", dashed(flags), fmt.Sprintf(format, args...)),
+		Flags:   flags,
+	}
+}
+
+// CredStore returns an *Error reporting that a cred store call failed.
+// retryable should only be true if the plugin had not yet written to the
+// store, as a retry may generate and store different values.
+func CredStore(err error, retryable bool) *Error {
+	return &Error{Code: CodeCredStore, Message: "cred store: " + err.Error(), Retryable: retryable}
+}
+
+// Internal returns an *Error reporting a bug in the plugin.
+func Internal(err error) *Error {
+	return &Error{Code: CodeInternal, Message: err.Error()}
+}
+
+// Envelope converts err into the *Error sent to the host.  An *Error is
+// returned as is, and an error wrapping one keeps its code and flags with
+// the wrapper's message.  Any other error becomes one with CodeUnknown.
+// It returns nil if err is nil.
+func Envelope(err error) *Error {
+	if err == nil {
+		return nil
+	}
+	e, ok := AsError(err)
+	if !ok {
+		return &Error{Code: CodeUnknown, Message: err.Error()}
+	}
+	if e == err {
+		return e
+	}
+	return &Error{Code: e.Code, Message: err.Error(), Flags: e.Flags, Retryable: e.Retryable}
+}
+
+// FromReply returns the error in a plugin's reply: env if it is set, or
+// an *Error with CodeUnknown for the plain message sent by older plugins.
+// It returns nil if neither is set.
+func FromReply(env *Error, message string) error {
+	if env != nil {
+		return env
+	}
+	if message != "" {
+		return &Error{Code: CodeUnknown, Message: message}
+	}
+	return nil
+}
+
+// causer is implemented by errors that wrap another error.
+type causer interface {
+	Cause() error
+}
+
+// Cause returns the error wrapped by e.
+func (e *TransportError) Cause() error {
+	return e.Err
+}
+
+// AsError returns the *Error sent by the plugin, looking through errors
+// that wrap it, such as a registry.PluginError.
+func AsError(err error) (*Error, bool) {
+	for err != nil {
+		if e, ok := err.(*Error); ok {
+			return e, true
+		}
+		c, ok := err.(causer)
+		if !ok {
+			break
+		}
+		err = c.Cause()
+	}
+	return nil, false
+}
+
+// CodeOf returns the code of the plugin's error, or CodeUnknown if err
+// did not come from the plugin.
+func CodeOf(err error) Code {
+	if e, ok := AsError(err); ok {
+		return e.Code
+	}
+	return CodeUnknown
+}
+
+// FlagsOf returns the flags named in the plugin's error.
+func FlagsOf(err error) []string {
+	if e, ok := AsError(err); ok {
+		return e.Flags
+	}
+	return nil
+}
+
+// IsRetryable reports whether the plugin said the failed call can safely
+// be made again.
+func IsRetryable(err error) bool {
+	e, ok := AsError(err)
+	return ok && e.Retryable
+}
+
+// ExitCode returns the exit status a command should use when it fails
+// with err, or 0 if err is nil.
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	e, ok := AsError(err)
+	if !ok {
+		for err != nil {
+			if IsTransport(err) {
+				return ExitUnavailable
+			}
+			c, ok := err.(causer)
+			if !ok {
+				break
+			}
+			err = c.Cause()
+		}
+		return ExitFailure
+	}
+	switch e.Code {
+	case CodeMissingFlags, CodeInvalidFlags:
+		return ExitUsage
+	case CodeCredStore:
+		return ExitIOErr
+	case CodeInternal:
+		return ExitSoftware
+	}
+	return ExitFailure
+}
+
+func dashed(flags []string) string {
+	res := make([]string, len(flags))
+	for i, f := range flags {
+		res[i] = "--" + f
+	}
+	return strings.Join(res, ", ")
+}
@@ -0,0 +1,110 @@
+package perr_test
+
+import (
+	"errors"
+
+	"github.com/enaml-ops/pluginlib/perr"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// wrapper wraps an error the way registry.PluginError does.
+type wrapper struct{ err error }
+
+func (w *wrapper) Error() string { return "wrapped: " + w.err.Error() }
+func (w *wrapper) Cause() error  { return w.err }
+
+var _ = Describe("Error", func() {
+	It("describes missing flags", func() {
+		err := perr.MissingFlags("user", "password")
+		Ω(err).Should(MatchError("missing required flags: --user, --password"))
+		Ω(err.Code).Should(Equal(perr.CodeMissingFlags))
+		Ω(err.Flags).Should(Equal([]string{"user", "password"}))
+		Ω(err.Retryable).Should(BeFalse())
+	})
+
+	It("describes invalid flags", func() {
+		err := perr.InvalidFlags([]string{"az"}, "%d zones given, need %d", 1, 3)
+		Ω(err).Should(MatchError("invalid --az: 1 zones given, need 3"))
+		Ω(err.Code).Should(Equal(perr.CodeInvalidFlags))
+	})
+
+	It("marks cred store failures as retryable when asked", func() {
+		err := perr.CredStore(errors.New("vault sealed"), true)
+		Ω(err).Should(MatchError("cred store: vault sealed"))
+		Ω(err.Retryable).Should(BeTrue())
+		Ω(perr.CredStore(errors.New("partial write"), false).Retryable).Should(BeFalse())
+	})
+
+	Context("Envelope", func() {
+		It("keeps an *Error", func() {
+			err := perr.Internal(errors.New("nil map"))
+			Ω(perr.Envelope(err)).Should(BeIdenticalTo(err))
+		})
+
+		It("keeps the code and flags of a wrapped *Error", func() {
+			err := &wrapper{perr.CredStore(errors.New("sealed"), true)}
+			Ω(perr.Envelope(err)).Should(Equal(&perr.Error{
+				Code:      perr.CodeCredStore,
+				Message:   "wrapped: cred store: sealed",
+				Retryable: true,
+			}))
+			env := perr.Envelope(&wrapper{perr.MissingFlags("user")})
+			Ω(env.Code).Should(Equal(perr.CodeMissingFlags))
+			Ω(env.Flags).Should(Equal([]string{"user"}))
+		})
+
+		It("gives other errors an unknown code", func() {
+			Ω(perr.Envelope(errors.New("boom"))).Should(Equal(&perr.Error{Code: perr.CodeUnknown, Message: "boom"}))
+		})
+
+		It("returns nil for nil", func() {
+			Ω(perr.Envelope(nil)).Should(BeNil())
+		})
+	})
+
+	Context("FromReply", func() {
+		It("prefers the envelope", func() {
+			env := perr.MissingFlags("user")
+			Ω(perr.FromReply(env, "missing")).Should(BeIdenticalTo(env))
+		})
+
+		It("wraps messages from older plugins", func() {
+			err := perr.FromReply(nil, "boom")
+			Ω(err).Should(MatchError("boom"))
+			Ω(perr.CodeOf(err)).Should(Equal(perr.CodeUnknown))
+		})
+
+		It("returns nil when there is no error", func() {
+			Ω(perr.FromReply(nil, "")).Should(BeNil())
+		})
+	})
+})
+
+var _ = Describe("host helpers", func() {
+	It("find the plugin's error through wrappers", func() {
+		err := &wrapper{perr.MissingFlags("user")}
+		Ω(perr.CodeOf(err)).Should(Equal(perr.CodeMissingFlags))
+		Ω(perr.FlagsOf(err)).Should(Equal([]string{"user"}))
+		Ω(perr.IsRetryable(err)).Should(BeFalse())
+		Ω(perr.IsRetryable(&wrapper{perr.CredStore(errors.New("sealed"), true)})).Should(BeTrue())
+	})
+
+	It("treat other errors as unknown", func() {
+		err := errors.New("boom")
+		Ω(perr.CodeOf(err)).Should(Equal(perr.CodeUnknown))
+		Ω(perr.FlagsOf(err)).Should(BeNil())
+		Ω(perr.IsRetryable(err)).Should(BeFalse())
+	})
+
+	It("map errors to exit codes", func() {
+		Ω(perr.ExitCode(nil)).Should(Equal(0))
+		Ω(perr.ExitCode(errors.New("boom"))).Should(Equal(perr.ExitFailure))
+		Ω(perr.ExitCode(perr.FromReply(nil, "boom"))).Should(Equal(perr.ExitFailure))
+		Ω(perr.ExitCode(&wrapper{perr.MissingFlags("user")})).Should(Equal(perr.ExitUsage))
+		Ω(perr.ExitCode(perr.InvalidFlags([]string{"az"}, "bad"))).Should(Equal(perr.ExitUsage))
+		Ω(perr.ExitCode(perr.CredStore(errors.New("sealed"), true))).Should(Equal(perr.ExitIOErr))
+		Ω(perr.ExitCode(perr.Internal(errors.New("bug")))).Should(Equal(perr.ExitSoftware))
+		Ω(perr.ExitCode(&wrapper{&perr.TransportError{Err: errors.New("EOF")}})).Should(Equal(perr.ExitUnavailable))
+	})
+})
@@ -0,0 +1,55 @@
+// Package perr defines the errors returned by calls to plugins over RPC.
+package perr
+
+import (
+	"fmt"
+	"net/rpc"
+)
+
+// TransportError is returned when a call could not reach the plugin or
+// its reply was lost, for example because the plugin process crashed.
+type TransportError struct {
+	Method string
+	Err    error
+}
+
+func (e *TransportError) Error() string {
+	return fmt.Sprintf("perr: calling %s: %v", e.Method, e.Err)
+}
+
+// RemoteError is returned when the plugin received a call but failed it.
+type RemoteError struct {
+	Method  string
+	Message string
+}
+
+func (e *RemoteError) Error() string {
+	return fmt.Sprintf("perr: %s failed in the plugin: %s", e.Method, e.Message)
+}
+
+// FromRPC converts an error returned by net/rpc for a call to method into a
+// *RemoteError when the plugin returned it, or a *TransportError otherwise.
+// It returns nil if err is nil.
+func FromRPC(method string, err error) error {
+	switch err := err.(type) {
+	case nil:
+		return nil
+	case rpc.ServerError:
+		return &RemoteError{Method: method, Message: string(err)}
+	case *TransportError, *RemoteError:
+		return err
+	}
+	return &TransportError{Method: method, Err: err}
+}
+
+// IsTransport reports whether err is a *TransportError.
+func IsTransport(err error) bool {
+	_, ok := err.(*TransportError)
+	return ok
+}
+
+// IsRemote reports whether err is a *RemoteError.
+func IsRemote(err error) bool {
+	_, ok := err.(*RemoteError)
+	return ok
+}
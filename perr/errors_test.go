@@ -0,0 +1,37 @@
+package perr_test
+
+import (
+	"errors"
+	"io"
+	"net/rpc"
+
+	"github.com/enaml-ops/pluginlib/perr"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("FromRPC", func() {
+	It("returns nil for successful calls", func() {
+		Ω(perr.FromRPC("Plugin.GetMeta", nil)).Should(BeNil())
+	})
+
+	It("treats errors returned by the plugin as remote errors", func() {
+		err := perr.FromRPC("Plugin.GetMeta", rpc.ServerError("rpc: can't find method Plugin.GetMeta"))
+		Ω(perr.IsRemote(err)).Should(BeTrue())
+		Ω(perr.IsTransport(err)).Should(BeFalse())
+		Ω(err.(*perr.RemoteError).Message).Should(Equal("rpc: can't find method Plugin.GetMeta"))
+	})
+
+	It("treats other errors as transport errors", func() {
+		for _, cause := range []error{rpc.ErrShutdown, io.ErrUnexpectedEOF, errors.New("connection reset")} {
+			err := perr.FromRPC("Plugin.GetFlags", cause)
+			Ω(perr.IsTransport(err)).Should(BeTrue())
+			Ω(err.(*perr.TransportError).Err).Should(Equal(cause))
+		}
+	})
+
+	It("does not wrap errors twice", func() {
+		err := perr.FromRPC("Plugin.GetMeta", io.EOF)
+		Ω(perr.FromRPC("Plugin.GetMeta", err)).Should(BeIdenticalTo(err))
+	})
+})
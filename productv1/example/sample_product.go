@@ -18,10 +18,29 @@ func (s *MyProduct) GetFlags() (flags []pcli.Flag) {
 
 func (s *MyProduct) GetMeta() product.Meta {
 	return product.Meta{
-		Name: "myfakeproduct",
+		Name:        "myfakeproduct",
+		Version:     "1.0.0",
+		Description: "a product for testing plugins",
+		Homepage:    "https://github.com/enaml-ops/pluginlib",
+		IaaS:        []string{"aws", "vsphere"},
+		Dependencies: []product.Dependency{
+			{Name: "cf", Version: ">=1.0.0"},
+		},
 	}
 }
 
 func (s *MyProduct) GetProduct(args []string, cloudconfig []byte, cs cred.Store) ([]byte, error) {
-	return []byte(""), nil
+	if cs == nil {
+		return []byte(""), nil
+	}
+	// reuse the password from an earlier deployment, or generate one
+	// and save it in the host's cred store
+	password, err := cs.Get("myfakeproduct", "password")
+	if err != nil {
+		password = "generated-password"
+		if err = cs.Post("myfakeproduct", "password", password); err != nil {
+			return nil, err
+		}
+	}
+	return []byte("password: " + password), nil
 }
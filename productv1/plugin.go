@@ -13,13 +13,13 @@ type Plugin struct {
 }
 
 // Server returns an RPC server that implements the ProductDeployer interface.
-func (p Plugin) Server(*plugin.MuxBroker) (interface{}, error) {
-	return &RPCServer{Impl: p.Plugin}, nil
+func (p Plugin) Server(b *plugin.MuxBroker) (interface{}, error) {
+	return &RPCServer{Impl: p.Plugin, broker: b}, nil
 }
 
 // Client returns an RPC client that implements the ProductDeployer interface.
 func (p Plugin) Client(b *plugin.MuxBroker, c *rpc.Client) (interface{}, error) {
-	return &RPC{client: c}, nil
+	return &RPC{client: c, broker: b}, nil
 }
 
 // NewProductPlugin decorates a ProductDeployer with the RPC functionality
@@ -6,6 +6,8 @@ import (
 
 	"github.com/enaml-ops/pluginlib/cred"
 	"github.com/enaml-ops/pluginlib/pcli"
+	"github.com/enaml-ops/pluginlib/perr"
+	plugin "github.com/hashicorp/go-plugin"
 	"github.com/xchapter7x/lo"
 )
 
@@ -14,77 +16,138 @@ type (
 	Args struct {
 		Args        []string
 		CloudConfig []byte
-		CredStore   cred.Store
+		// CredStoreID identifies the connection on which the host serves
+		// its cred.Store, or is zero if there is no store.
+		CredStoreID uint32
 	}
 	// Response contains the results of a GetProduct call.
 	Response struct {
 		Bytes  []byte
 		ErrRes string
+		// Err describes the plugin's error.  It is nil in replies from
+		// plugins that only set ErrRes.
+		Err *perr.Error
 	}
 )
 
 // RPC is an implementation of Deployer that talks over RPC.
 type RPC struct {
 	client *rpc.Client
+	broker *plugin.MuxBroker
 }
 
 // GetProduct calls a plugin's GetProduct method over RPC.
+// The cred store stays in the host and the plugin calls back into it,
+// so secrets the plugin generates are written to the host's store.
 func (p *RPC) GetProduct(args []string, cloudConfig []byte, cs cred.Store) ([]byte, error) {
 	lo.G.Debug("calling RPC client GetProduct")
+	var id uint32
+	if cs != nil {
+		if p.broker == nil {
+			return nil, errors.New("product: cannot pass a cred store without a connection broker")
+		}
+		id = p.broker.NextId()
+		go p.broker.AcceptAndServe(id, &cred.RPCServer{Impl: cs})
+	}
+
 	var resp Response
 	err := p.client.Call("Plugin.GetProduct", Args{
 		Args:        args,
 		CloudConfig: cloudConfig,
-		CredStore:   cs,
+		CredStoreID: id,
 	}, &resp)
+	if msg, ok := err.(rpc.ServerError); ok {
+		// older plugins fail the call instead of replying with the error
+		return nil, perr.FromReply(nil, string(msg))
+	}
 	if err != nil {
-		return nil, err
+		return nil, perr.FromRPC("Plugin.GetProduct", err)
 	}
 
-	if resp.ErrRes != "" {
-		lo.G.Debug("error:", resp.ErrRes)
-		return nil, errors.New(resp.ErrRes)
+	if err = perr.FromReply(resp.Err, resp.ErrRes); err != nil {
+		lo.G.Debug("error:", err)
+		return nil, err
 	}
 
 	return resp.Bytes, nil
 }
 
 // GetMeta calls a plugin's GetMeta method over RPC.
+// If the call fails the error is logged and an empty Meta is returned;
+// use GetMetaE to handle the error.
 func (p *RPC) GetMeta() Meta {
-	var resp Meta
-	if err := p.client.Call("Plugin.GetMeta", new(interface{}), &resp); err != nil {
-		panic(err)
+	resp, err := p.GetMetaE()
+	if err != nil {
+		lo.G.Error("GetMeta:", err)
 	}
 	return resp
 }
 
+// GetMetaE calls a plugin's GetMeta method over RPC.
+// It returns a *perr.TransportError if the plugin could not be reached
+// and a *perr.RemoteError if the plugin failed the call.
+func (p *RPC) GetMetaE() (Meta, error) {
+	var resp Meta
+	err := p.client.Call("Plugin.GetMeta", new(interface{}), &resp)
+	return resp, perr.FromRPC("Plugin.GetMeta", err)
+}
+
 // GetFlags calls a plugin's GetFlags method over RPC.
+// If the call fails the error is logged and no flags are returned;
+// use GetFlagsE to handle the error.
 func (p *RPC) GetFlags() []pcli.Flag {
-	var resp []pcli.Flag
-	if err := p.client.Call("Plugin.GetFlags", new(interface{}), &resp); err != nil {
-		panic(err)
+	resp, err := p.GetFlagsE()
+	if err != nil {
+		lo.G.Error("GetFlags:", err)
 	}
 	return resp
 }
 
+// GetFlagsE calls a plugin's GetFlags method over RPC.
+// It returns the same errors as GetMetaE.
+func (p *RPC) GetFlagsE() ([]pcli.Flag, error) {
+	var resp []pcli.Flag
+	err := p.client.Call("Plugin.GetFlags", new(interface{}), &resp)
+	return resp, perr.FromRPC("Plugin.GetFlags", err)
+}
+
 // RPCServer is the RPC server that ProductRPC connects to.
 // It conforms to the requirements of net/rpc.
 type RPCServer struct {
 	Impl Deployer
+
+	broker *plugin.MuxBroker
 }
 
 // GetProduct forwards the RPC request to the plugin's GetProduct method
 // and sends back the results.
+// If the host passed a cred store, the plugin is given a cred.Store
+// that calls back into it.
 func (p *RPCServer) GetProduct(args Args, resp *Response) error {
+	var cs cred.Store
+	if args.CredStoreID != 0 {
+		if p.broker == nil {
+			return errors.New("product: cannot reach the host's cred store without a connection broker")
+		}
+		conn, err := p.broker.Dial(args.CredStoreID)
+		if err != nil {
+			return err
+		}
+		client := rpc.NewClient(conn)
+		defer client.Close()
+		cs = cred.NewRPC(client)
+	}
+
 	var err error
-	resp.Bytes, err = p.Impl.GetProduct(args.Args, args.CloudConfig, args.CredStore)
+	resp.Bytes, err = p.Impl.GetProduct(args.Args, args.CloudConfig, cs)
 
+	// the error is sent in the reply rather than returned, since net/rpc
+	// only passes on the message of a returned error
+	resp.Err = perr.Envelope(err)
+	resp.ErrRes = ""
 	if err != nil {
 		resp.ErrRes = err.Error()
-		return err
 	}
-
-	resp.ErrRes = ""
 	return nil
 }
 
@@ -1,7 +1,12 @@
 package product_test
 
 import (
+	"errors"
+	"net"
+	"net/rpc"
+
 	"github.com/enaml-ops/pluginlib/pcli"
+	"github.com/enaml-ops/pluginlib/perr"
 	"github.com/enaml-ops/pluginlib/productv1"
 	"github.com/enaml-ops/pluginlib/productv1/productv1fakes"
 	. "github.com/onsi/ginkgo"
@@ -41,11 +46,20 @@ var _ = Describe("productv1 RPC", func() {
 		Ω(rpc.GetProduct(product.Args{
 			Args:        []string{"product"},
 			CloudConfig: []byte{0, 1, 2},
-			CredStore:   nil,
 		}, &resp)).Should(Succeed())
 		Ω(resp).Should(Equal(controlResp))
 	})
 
+	It("sends the plugin's error in the response", func() {
+		d.GetProductReturns(nil, perr.MissingFlags("user"))
+		rpc := product.RPCServer{Impl: d}
+
+		var resp product.Response
+		Ω(rpc.GetProduct(product.Args{}, &resp)).Should(Succeed())
+		Ω(resp.ErrRes).Should(Equal("missing required flags: --user"))
+		Ω(resp.Err).Should(Equal(perr.MissingFlags("user")))
+	})
+
 	It("Forwards calls to GetFlags", func() {
 		controlFlags := []pcli.Flag{
 			pcli.CreateStringFlag("str", "dummy", ""),
@@ -60,3 +74,72 @@ var _ = Describe("productv1 RPC", func() {
 		Ω(resp).Should(Equal(controlFlags))
 	})
 })
+
+var _ = Describe("productv1 RPC client", func() {
+	var (
+		d      *productv1fakes.FakeDeployer
+		client *rpc.Client
+		p      *product.RPC
+	)
+
+	BeforeEach(func() {
+		d = new(productv1fakes.FakeDeployer)
+		server := rpc.NewServer()
+		Ω(server.RegisterName("Plugin", &product.RPCServer{Impl: d})).Should(Succeed())
+		serverConn, clientConn := net.Pipe()
+		go server.ServeConn(serverConn)
+		client = rpc.NewClient(clientConn)
+
+		raw, err := product.Plugin{}.Client(nil, client)
+		Ω(err).ShouldNot(HaveOccurred())
+		p = raw.(*product.RPC)
+	})
+
+	It("returns the plugin's meta and flags", func() {
+		d.GetMetaReturns(product.Meta{Name: "fakemeta"})
+		d.GetFlagsReturns([]pcli.Flag{pcli.CreateBoolFlag("b", "dummy")})
+
+		meta, err := p.GetMetaE()
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(meta.Name).Should(Equal("fakemeta"))
+		flags, err := p.GetFlagsE()
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(flags).Should(HaveLen(1))
+	})
+
+	It("returns the plugin's structured errors", func() {
+		d.GetProductReturns(nil, perr.InvalidFlags([]string{"az"}, "need 3 zones"))
+		_, err := p.GetProduct(nil, nil, nil)
+		Ω(err).Should(MatchError("invalid --az: need 3 zones"))
+		Ω(perr.CodeOf(err)).Should(Equal(perr.CodeInvalidFlags))
+		Ω(perr.FlagsOf(err)).Should(Equal([]string{"az"}))
+	})
+
+	It("gives plain errors an unknown code", func() {
+		d.GetProductReturns(nil, errors.New("boom"))
+		_, err := p.GetProduct(nil, nil, nil)
+		Ω(err).Should(MatchError("boom"))
+		Ω(perr.CodeOf(err)).Should(Equal(perr.CodeUnknown))
+	})
+
+	Context("when the plugin cannot be reached", func() {
+		BeforeEach(func() {
+			client.Close()
+		})
+
+		It("returns a transport error", func() {
+			_, err := p.GetMetaE()
+			Ω(perr.IsTransport(err)).Should(BeTrue())
+			_, err = p.GetFlagsE()
+			Ω(perr.IsTransport(err)).Should(BeTrue())
+			_, err = p.GetProduct(nil, nil, nil)
+			Ω(perr.IsTransport(err)).Should(BeTrue())
+			Ω(perr.ExitCode(err)).Should(Equal(perr.ExitUnavailable))
+		})
+
+		It("does not panic", func() {
+			Ω(func() { p.GetMeta() }).ShouldNot(Panic())
+			Ω(func() { p.GetFlags() }).ShouldNot(Panic())
+		})
+	})
+})
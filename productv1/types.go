@@ -2,6 +2,8 @@
 package product
 
 import (
+	"fmt"
+
 	"github.com/enaml-ops/enaml"
 	"github.com/enaml-ops/pluginlib/cred"
 	"github.com/enaml-ops/pluginlib/pcli"
@@ -10,9 +12,31 @@ import (
 // Meta is the metadata for a product plugin.
 type Meta struct {
 	Name       string
+	Version    string
 	Properties map[string]interface{}
 	Releases   []enaml.Release
 	Stemcell   enaml.Stemcell
+
+	// Description is a short, human readable description of the product.
+	Description string
+	// Homepage is the URL of the product's documentation.
+	Homepage string
+	// IaaS lists the IaaS types the product can be deployed to, such as
+	// "aws" or "vsphere".  An empty list means any.
+	IaaS []string
+	// MinProtocol is the lowest plugin protocol version the host must
+	// support, or zero for any.
+	MinProtocol uint
+	// Dependencies lists the products that must be deployed first.
+	Dependencies []Dependency
+}
+
+// Dependency names a product that must be deployed before another.
+type Dependency struct {
+	Name string
+	// Version is a version range such as ">=1.2.0 <2.0.0" or "1.x".
+	// An empty range matches any version.
+	Version string
 }
 
 // Deployer is the interface implemented by V1 product plugins.
@@ -21,3 +45,39 @@ type Deployer interface {
 	GetMeta() Meta
 	GetFlags() []pcli.Flag
 }
+
+// DeployerE is implemented by Deployers, such as RPC, whose GetMeta and
+// GetFlags calls can fail.  The E variants return the error instead of
+// hiding it.
+type DeployerE interface {
+	GetMetaE() (Meta, error)
+	GetFlagsE() ([]pcli.Flag, error)
+}
+
+// GetMetaE returns d's Meta, using d.GetMetaE when d implements DeployerE.
+// A panic in d.GetMeta is returned as an error.
+func GetMetaE(d Deployer) (meta Meta, err error) {
+	if de, ok := d.(DeployerE); ok {
+		return de.GetMetaE()
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("product: GetMeta panicked: %v", r)
+		}
+	}()
+	return d.GetMeta(), nil
+}
+
+// GetFlagsE returns d's flags, using d.GetFlagsE when d implements DeployerE.
+// A panic in d.GetFlags is returned as an error.
+func GetFlagsE(d Deployer) (flags []pcli.Flag, err error) {
+	if de, ok := d.(DeployerE); ok {
+		return de.GetFlagsE()
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("product: GetFlags panicked: %v", r)
+		}
+	}()
+	return d.GetFlags(), nil
+}
@@ -0,0 +1,39 @@
+package product_test
+
+import (
+	"github.com/enaml-ops/pluginlib/pcli"
+	"github.com/enaml-ops/pluginlib/productv1"
+	"github.com/enaml-ops/pluginlib/productv1/productv1fakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("GetMetaE and GetFlagsE", func() {
+	var d *productv1fakes.FakeDeployer
+
+	BeforeEach(func() {
+		d = new(productv1fakes.FakeDeployer)
+	})
+
+	It("returns the results of a Deployer without E methods", func() {
+		d.GetMetaReturns(product.Meta{Name: "fakemeta"})
+		d.GetFlagsReturns([]pcli.Flag{pcli.CreateBoolFlag("b", "dummy")})
+
+		meta, err := product.GetMetaE(d)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(meta.Name).Should(Equal("fakemeta"))
+		flags, err := product.GetFlagsE(d)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(flags).Should(HaveLen(1))
+	})
+
+	It("returns panics as errors", func() {
+		d.GetMetaStub = func() product.Meta { panic("boom") }
+		d.GetFlagsStub = func() []pcli.Flag { panic("boom") }
+
+		_, err := product.GetMetaE(d)
+		Ω(err).Should(MatchError(ContainSubstring("boom")))
+		_, err = product.GetFlagsE(d)
+		Ω(err).Should(MatchError(ContainSubstring("boom")))
+	})
+})
@@ -0,0 +1,183 @@
+package product
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/enaml-ops/pluginlib/cred"
+)
+
+// Deployment is one of the BOSH deployments that make up a product.
+type Deployment struct {
+	Name     string
+	Manifest *Manifest
+	// DependsOn names the deployments of the same product that must be
+	// deployed before this one.
+	DependsOn []string
+}
+
+// CompositeDeployer is implemented by products made of several
+// deployments, such as a database, a service broker and its errands,
+// that have to be rolled out in order.
+type CompositeDeployer interface {
+	Deployer
+	GetDeployments(ctx context.Context, args []string, cloudConfig []byte, cs cred.Store) ([]Deployment, error)
+}
+
+// GetDeployments returns the deployments that make up d, calling its
+// GetDeployments method if it has one.  Other products are returned as a
+// single deployment named after their manifest.
+func GetDeployments(ctx context.Context, d Deployer, args []string, cloudConfig []byte, cs cred.Store) ([]Deployment, error) {
+	if cd, ok := d.(CompositeDeployer); ok {
+		return cd.GetDeployments(ctx, args, cloudConfig, cs)
+	}
+	return single(GetManifest(ctx, d, args, cloudConfig, cs))
+}
+
+// single returns the manifest of a product with one deployment.
+func single(m *Manifest, err error) ([]Deployment, error) {
+	if err != nil {
+		return nil, err
+	}
+	if m == nil || m.Deployment == nil {
+		return nil, errors.New("product: plugin returned no manifest")
+	}
+	return []Deployment{{Name: m.Deployment.Name, Manifest: m}}, nil
+}
+
+// Plan is the order in which a product's deployments are rolled out.
+// The deployments in each stage depend only on those in earlier stages,
+// so they can be deployed in parallel.
+type Plan [][]Deployment
+
+// NewPlan orders deployments so that each comes after the deployments it
+// depends on.  Within a stage deployments keep the order they were given
+// in.  It returns an error if names are missing or repeated, or if the
+// dependencies are unknown or circular.
+func NewPlan(deployments []Deployment) (Plan, error) {
+	index := make(map[string]bool, len(deployments))
+	for _, d := range deployments {
+		if d.Name == "" {
+			return nil, errors.New("product: deployment with no name")
+		}
+		if index[d.Name] {
+			return nil, fmt.Errorf("product: deployment %s is listed twice", d.Name)
+		}
+		index[d.Name] = true
+	}
+	for _, d := range deployments {
+		for _, dep := range d.DependsOn {
+			if !index[dep] {
+				return nil, fmt.Errorf("product: deployment %s depends on unknown deployment %s", d.Name, dep)
+			}
+		}
+	}
+
+	var plan Plan
+	done := make(map[string]bool, len(deployments))
+	remaining := deployments
+	for len(remaining) > 0 {
+		var stage, rest []Deployment
+		for _, d := range remaining {
+			if ready(d, done) {
+				stage = append(stage, d)
+			} else {
+				rest = append(rest, d)
+			}
+		}
+		if len(stage) == 0 {
+			var names []string
+			for _, d := range rest {
+				names = append(names, d.Name)
+			}
+			return nil, fmt.Errorf("product: circular dependencies between deployments %s", strings.Join(names, ", "))
+		}
+		for _, d := range stage {
+			done[d.Name] = true
+		}
+		plan = append(plan, stage)
+		remaining = rest
+	}
+	return plan, nil
+}
+
+func ready(d Deployment, done map[string]bool) bool {
+	for _, dep := range d.DependsOn {
+		if !done[dep] {
+			return false
+		}
+	}
+	return true
+}
+
+// DeployError is returned by Plan.Run when a deployment fails.
+type DeployError struct {
+	Deployment string
+	Err        error
+}
+
+func (e *DeployError) Error() string {
+	return fmt.Sprintf("product: deploying %s: %v", e.Deployment, e.Err)
+}
+
+// Cause returns the error returned by the deploy function.
+func (e *DeployError) Cause() error {
+	return e.Err
+}
+
+// Run calls deploy for each deployment in the plan, one stage after
+// another.  When parallel is true the deployments in a stage are
+// deployed at the same time; otherwise they are deployed in order.
+// Run stops at the first failure, cancelling the context passed to the
+// deployments still running, and returns a *DeployError.
+func (p Plan) Run(ctx context.Context, parallel bool, deploy func(context.Context, Deployment) error) error {
+	for _, stage := range p {
+		if !parallel {
+			for _, d := range stage {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				if err := deploy(ctx, d); err != nil {
+					return &DeployError{Deployment: d.Name, Err: err}
+				}
+			}
+			continue
+		}
+		if err := runStage(ctx, stage, deploy); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runStage deploys the deployments in stage in parallel.
+func runStage(ctx context.Context, stage []Deployment, deploy func(context.Context, Deployment) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg    sync.WaitGroup
+		once  sync.Once
+		first error
+	)
+	for _, d := range stage {
+		wg.Add(1)
+		go func(d Deployment) {
+			defer wg.Done()
+			if err := deploy(ctx, d); err != nil {
+				once.Do(func() {
+					first = &DeployError{Deployment: d.Name, Err: err}
+					cancel()
+				})
+			}
+		}(d)
+	}
+	wg.Wait()
+	return first
+}
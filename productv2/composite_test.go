@@ -0,0 +1,198 @@
+package product_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/enaml-ops/enaml"
+	"github.com/enaml-ops/pluginlib/perr"
+	"github.com/enaml-ops/pluginlib/productv2"
+	"github.com/enaml-ops/pluginlib/productv2/productv2fakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func deployment(name string, dependsOn ...string) product.Deployment {
+	return product.Deployment{
+		Name:      name,
+		Manifest:  &product.Manifest{Deployment: &enaml.DeploymentManifest{Name: name}},
+		DependsOn: dependsOn,
+	}
+}
+
+func stageNames(plan product.Plan) [][]string {
+	var res [][]string
+	for _, stage := range plan {
+		var names []string
+		for _, d := range stage {
+			names = append(names, d.Name)
+		}
+		res = append(res, names)
+	}
+	return res
+}
+
+var _ = Describe("composite products", func() {
+	var deployments []product.Deployment
+
+	BeforeEach(func() {
+		deployments = []product.Deployment{
+			deployment("errands", "broker"),
+			deployment("mysql"),
+			deployment("broker", "mysql", "rabbitmq"),
+			deployment("rabbitmq"),
+		}
+	})
+
+	Context("over RPC", func() {
+		It("sends every deployment", func() {
+			d := new(productv2fakes.FakeCompositeDeployer)
+			d.GetDeploymentsReturns(deployments, nil)
+			deployments[0].Manifest.Warnings = []string{"errands run once"}
+			raw, err := product.Plugin{Plugin: d}.Server(nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			p, client := serve(raw)
+			defer client.Close()
+
+			res, err := product.GetDeployments(context.Background(), p, nil, nil, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(res).Should(Equal(deployments))
+		})
+
+		It("returns the plugin's errors", func() {
+			d := new(productv2fakes.FakeCompositeDeployer)
+			d.GetDeploymentsReturns(nil, perr.MissingFlags("az"))
+			raw, err := product.Plugin{Plugin: d}.Server(nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			p, client := serve(raw)
+			defer client.Close()
+
+			_, err = p.GetDeployments(context.Background(), nil, nil, nil)
+			Ω(perr.CodeOf(err)).Should(Equal(perr.CodeMissingFlags))
+		})
+
+		It("returns other products as a single deployment", func() {
+			m := &product.Manifest{Deployment: &enaml.DeploymentManifest{Name: "concourse"}}
+			raw, err := product.Plugin{Plugin: newManifestDeployer(m)}.Server(nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			p, client := serve(raw)
+			defer client.Close()
+
+			res, err := p.GetDeployments(context.Background(), nil, nil, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(res).Should(HaveLen(1))
+			Ω(res[0].Name).Should(Equal("concourse"))
+			Ω(res[0].DependsOn).Should(BeEmpty())
+		})
+	})
+
+	Context("planning", func() {
+		It("orders deployments after their dependencies", func() {
+			plan, err := product.NewPlan(deployments)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(stageNames(plan)).Should(Equal([][]string{
+				{"mysql", "rabbitmq"},
+				{"broker"},
+				{"errands"},
+			}))
+		})
+
+		It("rejects invalid dependencies", func() {
+			for _, ds := range [][]product.Deployment{
+				{deployment("")},
+				{deployment("a"), deployment("a")},
+				{deployment("a", "b")},
+				{deployment("a", "c"), deployment("b", "a"), deployment("c", "b")},
+				{deployment("a", "a")},
+			} {
+				_, err := product.NewPlan(ds)
+				Ω(err).Should(HaveOccurred())
+			}
+		})
+	})
+
+	Context("running a plan", func() {
+		var (
+			plan product.Plan
+			mu   sync.Mutex
+			log  []string
+		)
+
+		record := func(name string) {
+			mu.Lock()
+			log = append(log, name)
+			mu.Unlock()
+		}
+
+		BeforeEach(func() {
+			var err error
+			plan, err = product.NewPlan(deployments)
+			Ω(err).ShouldNot(HaveOccurred())
+			log = nil
+		})
+
+		It("deploys in order", func() {
+			err := plan.Run(context.Background(), false, func(ctx context.Context, d product.Deployment) error {
+				record(d.Name)
+				return nil
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(log).Should(Equal([]string{"mysql", "rabbitmq", "broker", "errands"}))
+		})
+
+		It("deploys a stage in parallel", func() {
+			started := make(chan string, 2)
+			release := make(chan struct{})
+			go func() {
+				// both deployments of the first stage must start before
+				// either is allowed to finish
+				<-started
+				<-started
+				close(release)
+			}()
+			err := plan.Run(context.Background(), true, func(ctx context.Context, d product.Deployment) error {
+				if d.Name == "mysql" || d.Name == "rabbitmq" {
+					started <- d.Name
+					<-release
+				}
+				record(d.Name)
+				return nil
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(log[2:]).Should(Equal([]string{"broker", "errands"}))
+		})
+
+		It("stops at the first failure", func() {
+			err := plan.Run(context.Background(), true, func(ctx context.Context, d product.Deployment) error {
+				switch d.Name {
+				case "mysql":
+					return perr.CredStore(errors.New("sealed"), true)
+				case "rabbitmq":
+					select {
+					case <-ctx.Done():
+					case <-time.After(10 * time.Second):
+					}
+				}
+				record(d.Name)
+				return nil
+			})
+			Ω(err).Should(BeAssignableToTypeOf(&product.DeployError{}))
+			Ω(err.(*product.DeployError).Deployment).Should(Equal("mysql"))
+			Ω(perr.IsRetryable(err)).Should(BeTrue())
+			Ω(log).Should(Equal([]string{"rabbitmq"}))
+		})
+
+		It("stops when the context is cancelled", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			err := plan.Run(ctx, false, func(ctx context.Context, d product.Deployment) error {
+				record(d.Name)
+				cancel()
+				return nil
+			})
+			Ω(err).Should(Equal(context.Canceled))
+			Ω(log).Should(Equal([]string{"mysql"}))
+		})
+	})
+})
@@ -0,0 +1,67 @@
+package product
+
+import (
+	"context"
+
+	"github.com/enaml-ops/pluginlib/cred"
+)
+
+// DryRunResult is what a product would generate, and the credentials it
+// would have written, without any side effects.  Manifest and Raw are set
+// by DryRun and Deployments by DryRunDeployments.
+type DryRunResult struct {
+	Manifest *Manifest
+	// Raw is the manifest as the plugin returned it, which keeps anything
+	// enaml does not model.
+	Raw         []byte
+	Deployments []Deployment
+	Writes      []cred.Write
+}
+
+// DryRun asks d for its manifest without letting it change cs.  The
+// plugin reads from cs as usual, but its writes are recorded by a
+// cred.Recorder in the host and returned instead of being made, so
+// secrets it generates are never stored.  cs may be nil.
+func DryRun(ctx context.Context, d Deployer, args []string, cloudConfig []byte, cs cred.Store) (*DryRunResult, error) {
+	rec := cred.NewRecorder(cs)
+	m, b, err := manifestAndProduct(ctx, d, args, cloudConfig, rec)
+	if err != nil {
+		return nil, err
+	}
+	return &DryRunResult{Manifest: m, Raw: b, Writes: rec.Writes()}, nil
+}
+
+// DryRunDeployments is like DryRun, but asks d for its deployments with
+// GetDeployments, so that composite products can be dry run.
+func DryRunDeployments(ctx context.Context, d Deployer, args []string, cloudConfig []byte, cs cred.Store) (*DryRunResult, error) {
+	rec := cred.NewRecorder(cs)
+	deployments, err := GetDeployments(ctx, d, args, cloudConfig, rec)
+	if err != nil {
+		return nil, err
+	}
+	return &DryRunResult{Deployments: deployments, Writes: rec.Writes()}, nil
+}
+
+// manifestAndProduct returns the typed manifest for d along with the bytes
+// it was built from, calling the plugin only once.
+func manifestAndProduct(ctx context.Context, d Deployer, args []string, cloudConfig []byte, cs cred.Store) (*Manifest, []byte, error) {
+	switch d := d.(type) {
+	case *RPC:
+		return d.manifestAndProduct(ctx, args, cloudConfig, cs)
+	case ManifestDeployer:
+		m, err := d.GetManifest(ctx, args, cloudConfig, cs)
+		if err != nil {
+			return nil, nil, err
+		}
+		return m, m.Bytes(), nil
+	}
+	b, err := d.GetProduct(ctx, args, cloudConfig, cs)
+	if err != nil {
+		return nil, nil, err
+	}
+	m, err := NewManifest(b)
+	if err != nil {
+		return nil, nil, err
+	}
+	return m, b, nil
+}
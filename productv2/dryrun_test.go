@@ -0,0 +1,124 @@
+package product_test
+
+import (
+	"context"
+	"errors"
+
+	"github.com/enaml-ops/pluginlib/cred"
+	"github.com/enaml-ops/pluginlib/productv2"
+	"github.com/enaml-ops/pluginlib/productv2/productv2fakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// generateProduct reuses a password from the cred store or generates and
+// saves one.
+func generateProduct(ctx context.Context, args []string, cloudConfig []byte, cs cred.Store) ([]byte, error) {
+	password, err := cs.Get("concourse", "password")
+	if err != nil {
+		password = "generated"
+		if err = cs.Post("concourse", "password", password); err != nil {
+			return nil, err
+		}
+	}
+	if len(args) > 0 {
+		return nil, errors.New(args[0])
+	}
+	return []byte("name: concourse\nproperties:\n  password: " + password + "\n"), nil
+}
+
+// generateDeployments generates a password for the database of a
+// composite product.
+func generateDeployments(ctx context.Context, args []string, cloudConfig []byte, cs cred.Store) ([]product.Deployment, error) {
+	if err := cs.Post("mysql", "password", "generated"); err != nil {
+		return nil, err
+	}
+	return []product.Deployment{deployment("mysql"), deployment("broker", "mysql")}, nil
+}
+
+// mapStore is a cred.Store that counts writes.
+type mapStore struct {
+	values map[string]string
+	posts  int
+}
+
+func (s *mapStore) Get(path, key string) (string, error) {
+	if v, ok := s.values[path+"/"+key]; ok {
+		return v, nil
+	}
+	return "", errors.New("not found")
+}
+
+func (s *mapStore) GetBulk(path string) (map[string]string, error) {
+	return nil, errors.New("not supported")
+}
+
+func (s *mapStore) Post(path, key, value string) error {
+	s.posts++
+	return nil
+}
+
+func (s *mapStore) PostBulk(path string, values map[string]string) error {
+	s.posts++
+	return nil
+}
+
+var _ = Describe("DryRun", func() {
+	var d *productv2fakes.FakeDeployer
+
+	BeforeEach(func() {
+		d = new(productv2fakes.FakeDeployer)
+		d.GetProductStub = generateProduct
+	})
+
+	It("returns the manifest and the writes the product would make", func() {
+		store := &mapStore{values: map[string]string{}}
+		res, err := product.DryRun(context.Background(), d, nil, nil, store)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(res.Manifest.Deployment.Name).Should(Equal("concourse"))
+		Ω(res.Manifest.Deployment.Properties).Should(HaveKeyWithValue("password", "generated"))
+		Ω(string(res.Raw)).Should(Equal("name: concourse\nproperties:\n  password: generated\n"))
+		Ω(res.Writes).Should(Equal([]cred.Write{{Path: "concourse", Key: "password", Value: "generated"}}))
+		Ω(store.posts).Should(BeZero())
+	})
+
+	It("uses secrets that are already stored", func() {
+		store := &mapStore{values: map[string]string{"concourse/password": "stored"}}
+		res, err := product.DryRun(context.Background(), d, nil, nil, store)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(res.Manifest.Deployment.Properties).Should(HaveKeyWithValue("password", "stored"))
+		Ω(res.Writes).Should(BeEmpty())
+	})
+
+	It("returns the product's errors", func() {
+		_, err := product.DryRun(context.Background(), d, []string{"boom"}, nil, nil)
+		Ω(err).Should(MatchError("boom"))
+	})
+})
+
+var _ = Describe("DryRunDeployments", func() {
+	It("returns the deployments and the writes a composite product would make", func() {
+		// like many composite products it cannot return a single manifest
+		d := new(productv2fakes.FakeCompositeDeployer)
+		d.GetProductReturns(nil, errors.New("composite product has several manifests"))
+		d.GetDeploymentsStub = generateDeployments
+		store := &mapStore{values: map[string]string{}}
+		res, err := product.DryRunDeployments(context.Background(), d, nil, nil, store)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(res.Manifest).Should(BeNil())
+		Ω(res.Deployments).Should(HaveLen(2))
+		Ω(res.Deployments[1].DependsOn).Should(Equal([]string{"mysql"}))
+		Ω(res.Writes).Should(Equal([]cred.Write{{Path: "mysql", Key: "password", Value: "generated"}}))
+		Ω(store.posts).Should(BeZero())
+	})
+
+	It("returns other products as a single deployment", func() {
+		d := new(productv2fakes.FakeDeployer)
+		d.GetProductStub = generateProduct
+		res, err := product.DryRunDeployments(context.Background(), d, nil, nil, nil)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(res.Deployments).Should(HaveLen(1))
+		Ω(res.Deployments[0].Name).Should(Equal("concourse"))
+		Ω(res.Writes).Should(HaveLen(1))
+	})
+})
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+
+	"github.com/enaml-ops/enaml"
+	"github.com/enaml-ops/pluginlib/cred"
+	"github.com/enaml-ops/pluginlib/pcli"
+	"github.com/enaml-ops/pluginlib/productv2"
+)
+
+func main() {
+	product.Run(new(MyProduct))
+}
+
+type MyProduct struct{}
+
+func (s *MyProduct) GetFlags(ctx context.Context) ([]pcli.Flag, error) {
+	return nil, nil
+}
+
+func (s *MyProduct) GetMeta(ctx context.Context) (product.Meta, error) {
+	return product.Meta{
+		Name:    "myfakeproductv2",
+		Version: "2.0.0",
+	}, nil
+}
+
+func (s *MyProduct) GetProduct(ctx context.Context, args []string, cloudconfig []byte, cs cred.Store) ([]byte, error) {
+	return product.ManifestBytes(s.GetManifest(ctx, args, cloudconfig, cs))
+}
+
+func (s *MyProduct) GetManifest(ctx context.Context, args []string, cloudconfig []byte, cs cred.Store) (*product.Manifest, error) {
+	// a product that never finishes unless it is cancelled
+	if len(args) > 0 && args[0] == "--hang" {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	release := enaml.Release{Name: "myfakerelease", Version: "1.0.0"}
+	return &product.Manifest{
+		Deployment: &enaml.DeploymentManifest{
+			Name:     "myfakeproductv2",
+			Releases: []enaml.Release{release},
+		},
+		Releases: []enaml.Release{release},
+		Warnings: []string{"this product deploys nothing"},
+	}, nil
+}
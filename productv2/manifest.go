@@ -0,0 +1,81 @@
+package product
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/enaml-ops/enaml"
+	"github.com/enaml-ops/pluginlib/cred"
+	"gopkg.in/yaml.v2"
+)
+
+// Manifest is a deployment manifest along with what the plugin used and
+// generated while building it.
+type Manifest struct {
+	Deployment *enaml.DeploymentManifest
+	// Variables holds the values the plugin generated, such as passwords,
+	// by name.
+	Variables map[string]string
+	// Releases lists the releases the deployment uses.
+	Releases []enaml.Release
+	// Warnings are messages for the operator that did not stop the
+	// manifest from being built.
+	Warnings []string
+}
+
+// Bytes returns the deployment manifest as YAML, or nil if there is none.
+func (m *Manifest) Bytes() []byte {
+	if m.Deployment == nil {
+		return nil
+	}
+	return m.Deployment.Bytes()
+}
+
+// NewManifest parses a YAML deployment manifest, such as one returned by
+// GetProduct, into a Manifest with no side data.
+func NewManifest(b []byte) (*Manifest, error) {
+	dm := new(enaml.DeploymentManifest)
+	if err := yaml.Unmarshal(b, dm); err != nil {
+		return nil, fmt.Errorf("product: parsing manifest: %v", err)
+	}
+	return &Manifest{Deployment: dm}, nil
+}
+
+// ManifestDeployer is implemented by product plugins that can return a
+// typed manifest.  Such plugins usually implement GetProduct with
+// ManifestBytes:
+//
+//	func (p *MyProduct) GetProduct(ctx context.Context, args []string, cloudConfig []byte, cs cred.Store) ([]byte, error) {
+//		return product.ManifestBytes(p.GetManifest(ctx, args, cloudConfig, cs))
+//	}
+type ManifestDeployer interface {
+	Deployer
+	GetManifest(ctx context.Context, args []string, cloudConfig []byte, cs cred.Store) (*Manifest, error)
+}
+
+// ManifestBytes returns the YAML for the manifest returned by GetManifest.
+func ManifestBytes(m *Manifest, err error) ([]byte, error) {
+	if err != nil {
+		return nil, err
+	}
+	return m.Bytes(), nil
+}
+
+// GetManifest returns the typed manifest for d, calling its GetManifest
+// method if it has one, and otherwise parsing the result of GetProduct.
+// The RPC client always has the method and falls back to GetProduct for
+// plugins that do not.
+func GetManifest(ctx context.Context, d Deployer, args []string, cloudConfig []byte, cs cred.Store) (*Manifest, error) {
+	if md, ok := d.(ManifestDeployer); ok {
+		return md.GetManifest(ctx, args, cloudConfig, cs)
+	}
+	return ManifestFromProduct(d.GetProduct(ctx, args, cloudConfig, cs))
+}
+
+// ManifestFromProduct parses the manifest returned by GetProduct.
+func ManifestFromProduct(b []byte, err error) (*Manifest, error) {
+	if err != nil {
+		return nil, err
+	}
+	return NewManifest(b)
+}
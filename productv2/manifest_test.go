@@ -0,0 +1,152 @@
+package product_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/rpc"
+
+	"github.com/enaml-ops/enaml"
+	"github.com/enaml-ops/pluginlib/cred"
+	"github.com/enaml-ops/pluginlib/perr"
+	"github.com/enaml-ops/pluginlib/productv2"
+	"github.com/enaml-ops/pluginlib/productv2/productv2fakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// newManifestDeployer returns a fake product that returns m as a typed
+// manifest.
+func newManifestDeployer(m *product.Manifest) *productv2fakes.FakeManifestDeployer {
+	d := new(productv2fakes.FakeManifestDeployer)
+	d.GetManifestReturns(m, nil)
+	d.GetProductStub = func(ctx context.Context, args []string, cloudConfig []byte, cs cred.Store) ([]byte, error) {
+		return product.ManifestBytes(d.GetManifest(ctx, args, cloudConfig, cs))
+	}
+	d.GetMetaReturns(product.Meta{Name: "manifest"}, nil)
+	return d
+}
+
+// productOnly hides GetManifest from the RPC server, like a plugin built
+// before it existed.
+type productOnly struct {
+	*product.RPCServer
+}
+
+func (s *productOnly) GetManifest() {}
+
+// serve returns an RPC client for a plugin serving rcvr.
+func serve(rcvr interface{}) (*product.RPC, *rpc.Client) {
+	server := rpc.NewServer()
+	Ω(server.RegisterName("Plugin", rcvr)).Should(Succeed())
+	serverConn, clientConn := net.Pipe()
+	go server.ServeConn(serverConn)
+	client := rpc.NewClient(clientConn)
+	raw, err := product.Plugin{}.Client(nil, client)
+	Ω(err).ShouldNot(HaveOccurred())
+	return raw.(*product.RPC), client
+}
+
+var _ = Describe("Manifest", func() {
+	release := enaml.Release{Name: "concourse", Version: "1.2.0"}
+	manifest := &product.Manifest{
+		Deployment: &enaml.DeploymentManifest{
+			Name:     "concourse",
+			Releases: []enaml.Release{release},
+		},
+		Variables: map[string]string{"admin-password": "secret"},
+		Releases:  []enaml.Release{release},
+		Warnings:  []string{"no TLS certificate given"},
+	}
+
+	It("parses YAML manifests", func() {
+		m, err := product.NewManifest([]byte("name: concourse\nreleases:\n- name: concourse\n  version: 1.2.0\n"))
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(m.Deployment.Name).Should(Equal("concourse"))
+		Ω(m.Deployment.Releases).Should(Equal([]enaml.Release{release}))
+	})
+
+	It("returns an error for invalid YAML", func() {
+		_, err := product.NewManifest([]byte("name: [concourse"))
+		Ω(err).Should(HaveOccurred())
+	})
+
+	It("round trips through its bytes", func() {
+		m, err := product.NewManifest(manifest.Bytes())
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(m.Deployment).Should(Equal(manifest.Deployment))
+	})
+
+	Context("when the plugin is a ManifestDeployer", func() {
+		var (
+			d      *productv2fakes.FakeManifestDeployer
+			p      *product.RPC
+			client *rpc.Client
+		)
+
+		BeforeEach(func() {
+			d = newManifestDeployer(manifest)
+			raw, err := product.Plugin{Plugin: d}.Server(nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			p, client = serve(raw)
+		})
+
+		AfterEach(func() {
+			client.Close()
+		})
+
+		It("sends the manifest and its side data", func() {
+			m, err := product.GetManifest(context.Background(), p, nil, nil, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(m).Should(Equal(manifest))
+		})
+
+		It("sends the manifest's bytes from GetProduct", func() {
+			b, err := p.GetProduct(context.Background(), nil, nil, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(b).Should(Equal(manifest.Bytes()))
+		})
+
+		It("returns the plugin's errors", func() {
+			d.GetManifestReturns(nil, perr.MissingFlags("web-ip"))
+			_, err := p.GetManifest(context.Background(), nil, nil, nil)
+			Ω(perr.CodeOf(err)).Should(Equal(perr.CodeMissingFlags))
+			_, err = p.GetProduct(context.Background(), nil, nil, nil)
+			Ω(perr.CodeOf(err)).Should(Equal(perr.CodeMissingFlags))
+		})
+	})
+
+	Context("when the plugin only implements GetProduct", func() {
+		var (
+			d      *productv2fakes.FakeDeployer
+			server *product.RPCServer
+		)
+
+		BeforeEach(func() {
+			d = newFakeDeployer()
+			server = &product.RPCServer{Impl: d}
+		})
+
+		It("parses the result of GetProduct", func() {
+			p, client := serve(server)
+			defer client.Close()
+			_, err := p.GetManifest(context.Background(), nil, nil, nil)
+			// the fake's "manifest" is not a YAML mapping
+			Ω(err).Should(MatchError(ContainSubstring("parsing manifest")))
+		})
+
+		It("falls back to GetProduct for plugins without GetManifest", func() {
+			p, client := serve(&productOnly{server})
+			defer client.Close()
+			_, err := p.GetManifest(context.Background(), nil, nil, nil)
+			Ω(err).Should(MatchError(ContainSubstring("parsing manifest")))
+			Ω(d.GetProductCallCount()).Should(Equal(1))
+		})
+
+		It("returns errors from GetProduct", func() {
+			d.GetProductReturns(nil, errors.New("boom"))
+			_, err := product.GetManifest(context.Background(), d, nil, nil, nil)
+			Ω(err).Should(MatchError("boom"))
+		})
+	})
+})
@@ -0,0 +1,63 @@
+package product
+
+import (
+	"net/rpc"
+	"os"
+
+	v1 "github.com/enaml-ops/pluginlib/productv1"
+	plugin "github.com/hashicorp/go-plugin"
+)
+
+// Plugin wraps up the RPC server and client into a single type.
+type Plugin struct {
+	Plugin Deployer
+}
+
+// Server returns an RPC server that implements the Deployer interface.
+func (p Plugin) Server(b *plugin.MuxBroker) (interface{}, error) {
+	return &RPCServer{Impl: p.Plugin, broker: b}, nil
+}
+
+// Client returns an RPC client that implements the Deployer interface.
+func (p Plugin) Client(b *plugin.MuxBroker, c *rpc.Client) (interface{}, error) {
+	return &RPC{client: c, broker: b}, nil
+}
+
+// NewProductPlugin decorates a Deployer with the RPC functionality
+// required to operate as a product plugin.
+func NewProductPlugin(pd Deployer) Plugin {
+	return Plugin{Plugin: pd}
+}
+
+// PluginsMapHash is an identifier for plugins registered with the go-plugin library.
+const PluginsMapHash = "product"
+
+// HandshakeConfig is the configuration for establishing communication
+// between the CLI and V2 plugins.  It differs from V1 only in its
+// protocol version.
+var HandshakeConfig = plugin.HandshakeConfig{
+	ProtocolVersion:  3,
+	MagicCookieKey:   "BASIC_PLUGIN",
+	MagicCookieValue: "hello",
+}
+
+// Run runs a Deployer as an RPC server.
+// It should be called from a plugin's func main.
+// The plugin also speaks the V1 protocol, which is used with hosts that
+// do not support V2.
+func Run(p Deployer) {
+	if len(os.Args) >= 2 && os.Args[1] != "" {
+		plugin.Serve(&plugin.ServeConfig{
+			HandshakeConfig: HandshakeConfig,
+			VersionedPlugins: map[int]plugin.PluginSet{
+				int(HandshakeConfig.ProtocolVersion): {
+					PluginsMapHash: NewProductPlugin(p),
+				},
+				int(v1.HandshakeConfig.ProtocolVersion): {
+					v1.PluginsMapHash: v1.NewProductPlugin(AsV1(p)),
+				},
+			},
+		})
+		return
+	}
+}
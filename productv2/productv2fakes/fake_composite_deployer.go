@@ -0,0 +1,196 @@
+// This file was generated by counterfeiter
+package productv2fakes
+
+import (
+	"context"
+	"sync"
+
+	"github.com/enaml-ops/pluginlib/cred"
+	"github.com/enaml-ops/pluginlib/pcli"
+	"github.com/enaml-ops/pluginlib/productv2"
+)
+
+type FakeCompositeDeployer struct {
+	GetProductStub        func(ctx context.Context, args []string, cloudConfig []byte, cs cred.Store) ([]byte, error)
+	getProductMutex       sync.RWMutex
+	getProductArgsForCall []struct {
+		ctx         context.Context
+		args        []string
+		cloudConfig []byte
+		cs          cred.Store
+	}
+	getProductReturns struct {
+		result1 []byte
+		result2 error
+	}
+	GetMetaStub        func(ctx context.Context) (product.Meta, error)
+	getMetaMutex       sync.RWMutex
+	getMetaArgsForCall []struct {
+		ctx context.Context
+	}
+	getMetaReturns struct {
+		result1 product.Meta
+		result2 error
+	}
+	GetFlagsStub        func(ctx context.Context) ([]pcli.Flag, error)
+	getFlagsMutex       sync.RWMutex
+	getFlagsArgsForCall []struct {
+		ctx context.Context
+	}
+	getFlagsReturns struct {
+		result1 []pcli.Flag
+		result2 error
+	}
+	GetDeploymentsStub        func(ctx context.Context, args []string, cloudConfig []byte, cs cred.Store) ([]product.Deployment, error)
+	getDeploymentsMutex       sync.RWMutex
+	getDeploymentsArgsForCall []struct {
+		ctx         context.Context
+		args        []string
+		cloudConfig []byte
+		cs          cred.Store
+	}
+	getDeploymentsReturns struct {
+		result1 []product.Deployment
+		result2 error
+	}
+}
+
+func (fake *FakeCompositeDeployer) GetProduct(ctx context.Context, args []string, cloudConfig []byte, cs cred.Store) ([]byte, error) {
+	fake.getProductMutex.Lock()
+	fake.getProductArgsForCall = append(fake.getProductArgsForCall, struct {
+		ctx         context.Context
+		args        []string
+		cloudConfig []byte
+		cs          cred.Store
+	}{ctx, args, cloudConfig, cs})
+	fake.getProductMutex.Unlock()
+	if fake.GetProductStub != nil {
+		return fake.GetProductStub(ctx, args, cloudConfig, cs)
+	} else {
+		return fake.getProductReturns.result1, fake.getProductReturns.result2
+	}
+}
+
+func (fake *FakeCompositeDeployer) GetProductCallCount() int {
+	fake.getProductMutex.RLock()
+	defer fake.getProductMutex.RUnlock()
+	return len(fake.getProductArgsForCall)
+}
+
+func (fake *FakeCompositeDeployer) GetProductArgsForCall(i int) (context.Context, []string, []byte, cred.Store) {
+	fake.getProductMutex.RLock()
+	defer fake.getProductMutex.RUnlock()
+	return fake.getProductArgsForCall[i].ctx, fake.getProductArgsForCall[i].args, fake.getProductArgsForCall[i].cloudConfig, fake.getProductArgsForCall[i].cs
+}
+
+func (fake *FakeCompositeDeployer) GetProductReturns(result1 []byte, result2 error) {
+	fake.GetProductStub = nil
+	fake.getProductReturns = struct {
+		result1 []byte
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeCompositeDeployer) GetMeta(ctx context.Context) (product.Meta, error) {
+	fake.getMetaMutex.Lock()
+	fake.getMetaArgsForCall = append(fake.getMetaArgsForCall, struct {
+		ctx context.Context
+	}{ctx})
+	fake.getMetaMutex.Unlock()
+	if fake.GetMetaStub != nil {
+		return fake.GetMetaStub(ctx)
+	} else {
+		return fake.getMetaReturns.result1, fake.getMetaReturns.result2
+	}
+}
+
+func (fake *FakeCompositeDeployer) GetMetaCallCount() int {
+	fake.getMetaMutex.RLock()
+	defer fake.getMetaMutex.RUnlock()
+	return len(fake.getMetaArgsForCall)
+}
+
+func (fake *FakeCompositeDeployer) GetMetaArgsForCall(i int) context.Context {
+	fake.getMetaMutex.RLock()
+	defer fake.getMetaMutex.RUnlock()
+	return fake.getMetaArgsForCall[i].ctx
+}
+
+func (fake *FakeCompositeDeployer) GetMetaReturns(result1 product.Meta, result2 error) {
+	fake.GetMetaStub = nil
+	fake.getMetaReturns = struct {
+		result1 product.Meta
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeCompositeDeployer) GetFlags(ctx context.Context) ([]pcli.Flag, error) {
+	fake.getFlagsMutex.Lock()
+	fake.getFlagsArgsForCall = append(fake.getFlagsArgsForCall, struct {
+		ctx context.Context
+	}{ctx})
+	fake.getFlagsMutex.Unlock()
+	if fake.GetFlagsStub != nil {
+		return fake.GetFlagsStub(ctx)
+	} else {
+		return fake.getFlagsReturns.result1, fake.getFlagsReturns.result2
+	}
+}
+
+func (fake *FakeCompositeDeployer) GetFlagsCallCount() int {
+	fake.getFlagsMutex.RLock()
+	defer fake.getFlagsMutex.RUnlock()
+	return len(fake.getFlagsArgsForCall)
+}
+
+func (fake *FakeCompositeDeployer) GetFlagsArgsForCall(i int) context.Context {
+	fake.getFlagsMutex.RLock()
+	defer fake.getFlagsMutex.RUnlock()
+	return fake.getFlagsArgsForCall[i].ctx
+}
+
+func (fake *FakeCompositeDeployer) GetFlagsReturns(result1 []pcli.Flag, result2 error) {
+	fake.GetFlagsStub = nil
+	fake.getFlagsReturns = struct {
+		result1 []pcli.Flag
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeCompositeDeployer) GetDeployments(ctx context.Context, args []string, cloudConfig []byte, cs cred.Store) ([]product.Deployment, error) {
+	fake.getDeploymentsMutex.Lock()
+	fake.getDeploymentsArgsForCall = append(fake.getDeploymentsArgsForCall, struct {
+		ctx         context.Context
+		args        []string
+		cloudConfig []byte
+		cs          cred.Store
+	}{ctx, args, cloudConfig, cs})
+	fake.getDeploymentsMutex.Unlock()
+	if fake.GetDeploymentsStub != nil {
+		return fake.GetDeploymentsStub(ctx, args, cloudConfig, cs)
+	} else {
+		return fake.getDeploymentsReturns.result1, fake.getDeploymentsReturns.result2
+	}
+}
+
+func (fake *FakeCompositeDeployer) GetDeploymentsCallCount() int {
+	fake.getDeploymentsMutex.RLock()
+	defer fake.getDeploymentsMutex.RUnlock()
+	return len(fake.getDeploymentsArgsForCall)
+}
+
+func (fake *FakeCompositeDeployer) GetDeploymentsArgsForCall(i int) (context.Context, []string, []byte, cred.Store) {
+	fake.getDeploymentsMutex.RLock()
+	defer fake.getDeploymentsMutex.RUnlock()
+	return fake.getDeploymentsArgsForCall[i].ctx, fake.getDeploymentsArgsForCall[i].args, fake.getDeploymentsArgsForCall[i].cloudConfig, fake.getDeploymentsArgsForCall[i].cs
+}
+
+func (fake *FakeCompositeDeployer) GetDeploymentsReturns(result1 []product.Deployment, result2 error) {
+	fake.GetDeploymentsStub = nil
+	fake.getDeploymentsReturns = struct {
+		result1 []product.Deployment
+		result2 error
+	}{result1, result2}
+}
+
+var _ product.CompositeDeployer = new(FakeCompositeDeployer)
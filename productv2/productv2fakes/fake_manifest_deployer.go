@@ -0,0 +1,196 @@
+// This file was generated by counterfeiter
+package productv2fakes
+
+import (
+	"context"
+	"sync"
+
+	"github.com/enaml-ops/pluginlib/cred"
+	"github.com/enaml-ops/pluginlib/pcli"
+	"github.com/enaml-ops/pluginlib/productv2"
+)
+
+type FakeManifestDeployer struct {
+	GetProductStub        func(ctx context.Context, args []string, cloudConfig []byte, cs cred.Store) ([]byte, error)
+	getProductMutex       sync.RWMutex
+	getProductArgsForCall []struct {
+		ctx         context.Context
+		args        []string
+		cloudConfig []byte
+		cs          cred.Store
+	}
+	getProductReturns struct {
+		result1 []byte
+		result2 error
+	}
+	GetMetaStub        func(ctx context.Context) (product.Meta, error)
+	getMetaMutex       sync.RWMutex
+	getMetaArgsForCall []struct {
+		ctx context.Context
+	}
+	getMetaReturns struct {
+		result1 product.Meta
+		result2 error
+	}
+	GetFlagsStub        func(ctx context.Context) ([]pcli.Flag, error)
+	getFlagsMutex       sync.RWMutex
+	getFlagsArgsForCall []struct {
+		ctx context.Context
+	}
+	getFlagsReturns struct {
+		result1 []pcli.Flag
+		result2 error
+	}
+	GetManifestStub        func(ctx context.Context, args []string, cloudConfig []byte, cs cred.Store) (*product.Manifest, error)
+	getManifestMutex       sync.RWMutex
+	getManifestArgsForCall []struct {
+		ctx         context.Context
+		args        []string
+		cloudConfig []byte
+		cs          cred.Store
+	}
+	getManifestReturns struct {
+		result1 *product.Manifest
+		result2 error
+	}
+}
+
+func (fake *FakeManifestDeployer) GetProduct(ctx context.Context, args []string, cloudConfig []byte, cs cred.Store) ([]byte, error) {
+	fake.getProductMutex.Lock()
+	fake.getProductArgsForCall = append(fake.getProductArgsForCall, struct {
+		ctx         context.Context
+		args        []string
+		cloudConfig []byte
+		cs          cred.Store
+	}{ctx, args, cloudConfig, cs})
+	fake.getProductMutex.Unlock()
+	if fake.GetProductStub != nil {
+		return fake.GetProductStub(ctx, args, cloudConfig, cs)
+	} else {
+		return fake.getProductReturns.result1, fake.getProductReturns.result2
+	}
+}
+
+func (fake *FakeManifestDeployer) GetProductCallCount() int {
+	fake.getProductMutex.RLock()
+	defer fake.getProductMutex.RUnlock()
+	return len(fake.getProductArgsForCall)
+}
+
+func (fake *FakeManifestDeployer) GetProductArgsForCall(i int) (context.Context, []string, []byte, cred.Store) {
+	fake.getProductMutex.RLock()
+	defer fake.getProductMutex.RUnlock()
+	return fake.getProductArgsForCall[i].ctx, fake.getProductArgsForCall[i].args, fake.getProductArgsForCall[i].cloudConfig, fake.getProductArgsForCall[i].cs
+}
+
+func (fake *FakeManifestDeployer) GetProductReturns(result1 []byte, result2 error) {
+	fake.GetProductStub = nil
+	fake.getProductReturns = struct {
+		result1 []byte
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeManifestDeployer) GetMeta(ctx context.Context) (product.Meta, error) {
+	fake.getMetaMutex.Lock()
+	fake.getMetaArgsForCall = append(fake.getMetaArgsForCall, struct {
+		ctx context.Context
+	}{ctx})
+	fake.getMetaMutex.Unlock()
+	if fake.GetMetaStub != nil {
+		return fake.GetMetaStub(ctx)
+	} else {
+		return fake.getMetaReturns.result1, fake.getMetaReturns.result2
+	}
+}
+
+func (fake *FakeManifestDeployer) GetMetaCallCount() int {
+	fake.getMetaMutex.RLock()
+	defer fake.getMetaMutex.RUnlock()
+	return len(fake.getMetaArgsForCall)
+}
+
+func (fake *FakeManifestDeployer) GetMetaArgsForCall(i int) context.Context {
+	fake.getMetaMutex.RLock()
+	defer fake.getMetaMutex.RUnlock()
+	return fake.getMetaArgsForCall[i].ctx
+}
+
+func (fake *FakeManifestDeployer) GetMetaReturns(result1 product.Meta, result2 error) {
+	fake.GetMetaStub = nil
+	fake.getMetaReturns = struct {
+		result1 product.Meta
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeManifestDeployer) GetFlags(ctx context.Context) ([]pcli.Flag, error) {
+	fake.getFlagsMutex.Lock()
+	fake.getFlagsArgsForCall = append(fake.getFlagsArgsForCall, struct {
+		ctx context.Context
+	}{ctx})
+	fake.getFlagsMutex.Unlock()
+	if fake.GetFlagsStub != nil {
+		return fake.GetFlagsStub(ctx)
+	} else {
+		return fake.getFlagsReturns.result1, fake.getFlagsReturns.result2
+	}
+}
+
+func (fake *FakeManifestDeployer) GetFlagsCallCount() int {
+	fake.getFlagsMutex.RLock()
+	defer fake.getFlagsMutex.RUnlock()
+	return len(fake.getFlagsArgsForCall)
+}
+
+func (fake *FakeManifestDeployer) GetFlagsArgsForCall(i int) context.Context {
+	fake.getFlagsMutex.RLock()
+	defer fake.getFlagsMutex.RUnlock()
+	return fake.getFlagsArgsForCall[i].ctx
+}
+
+func (fake *FakeManifestDeployer) GetFlagsReturns(result1 []pcli.Flag, result2 error) {
+	fake.GetFlagsStub = nil
+	fake.getFlagsReturns = struct {
+		result1 []pcli.Flag
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeManifestDeployer) GetManifest(ctx context.Context, args []string, cloudConfig []byte, cs cred.Store) (*product.Manifest, error) {
+	fake.getManifestMutex.Lock()
+	fake.getManifestArgsForCall = append(fake.getManifestArgsForCall, struct {
+		ctx         context.Context
+		args        []string
+		cloudConfig []byte
+		cs          cred.Store
+	}{ctx, args, cloudConfig, cs})
+	fake.getManifestMutex.Unlock()
+	if fake.GetManifestStub != nil {
+		return fake.GetManifestStub(ctx, args, cloudConfig, cs)
+	} else {
+		return fake.getManifestReturns.result1, fake.getManifestReturns.result2
+	}
+}
+
+func (fake *FakeManifestDeployer) GetManifestCallCount() int {
+	fake.getManifestMutex.RLock()
+	defer fake.getManifestMutex.RUnlock()
+	return len(fake.getManifestArgsForCall)
+}
+
+func (fake *FakeManifestDeployer) GetManifestArgsForCall(i int) (context.Context, []string, []byte, cred.Store) {
+	fake.getManifestMutex.RLock()
+	defer fake.getManifestMutex.RUnlock()
+	return fake.getManifestArgsForCall[i].ctx, fake.getManifestArgsForCall[i].args, fake.getManifestArgsForCall[i].cloudConfig, fake.getManifestArgsForCall[i].cs
+}
+
+func (fake *FakeManifestDeployer) GetManifestReturns(result1 *product.Manifest, result2 error) {
+	fake.GetManifestStub = nil
+	fake.getManifestReturns = struct {
+		result1 *product.Manifest
+		result2 error
+	}{result1, result2}
+}
+
+var _ product.ManifestDeployer = new(FakeManifestDeployer)
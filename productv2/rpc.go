@@ -0,0 +1,502 @@
+package product
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/rpc"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/enaml-ops/enaml"
+	"github.com/enaml-ops/pluginlib/cred"
+	"github.com/enaml-ops/pluginlib/pcli"
+	"github.com/enaml-ops/pluginlib/perr"
+	plugin "github.com/hashicorp/go-plugin"
+	"github.com/xchapter7x/lo"
+)
+
+type (
+	// Call carries a call's ID and its context's deadline to the plugin.
+	// The host cancels a call by sending its ID to the Cancel method.
+	Call struct {
+		ID       uint64
+		Deadline time.Time
+	}
+	// Args contains the args for a GetProduct call.
+	Args struct {
+		Call        Call
+		Args        []string
+		CloudConfig []byte
+		// CredStoreID identifies the connection on which the host serves
+		// its cred.Store, or is zero if there is no store.
+		CredStoreID uint32
+	}
+	// Response contains the results of a GetProduct call.
+	// ErrRes holds the message of the plugin's error and Err the error.
+	Response struct {
+		Bytes  []byte
+		ErrRes string
+		Err    *perr.Error
+	}
+	// MetaResponse contains the results of a GetMeta call.
+	MetaResponse struct {
+		Meta   Meta
+		ErrRes string
+		Err    *perr.Error
+	}
+	// ManifestResponse contains the results of a GetManifest call.
+	// The deployment manifest is sent as YAML.
+	ManifestResponse struct {
+		Manifest  []byte
+		Variables map[string]string
+		Releases  []enaml.Release
+		Warnings  []string
+		ErrRes    string
+		Err       *perr.Error
+	}
+	// DeploymentsResponse contains the results of a GetDeployments call.
+	DeploymentsResponse struct {
+		Deployments []DeploymentResponse
+		ErrRes      string
+		Err         *perr.Error
+	}
+	// DeploymentResponse is one of the deployments in a
+	// DeploymentsResponse.  The deployment manifest is sent as YAML.
+	DeploymentResponse struct {
+		Name      string
+		DependsOn []string
+		Manifest  []byte
+		Variables map[string]string
+		Releases  []enaml.Release
+		Warnings  []string
+	}
+	// FlagsResponse contains the results of a GetFlags call.
+	FlagsResponse struct {
+		Flags  []pcli.Flag
+		ErrRes string
+		Err    *perr.Error
+	}
+)
+
+// RPC is an implementation of Deployer that talks over RPC.
+// Errors returned by the plugin are passed through as they are, failed
+// calls return a *perr.TransportError or *perr.RemoteError, and calls
+// whose context is done return ctx.Err().
+type RPC struct {
+	nextID uint64 // accessed atomically; first for alignment
+	client *rpc.Client
+	broker *plugin.MuxBroker
+}
+
+// GetProduct calls a plugin's GetProduct method over RPC.
+// The cred store stays in the host and the plugin calls back into it.
+func (p *RPC) GetProduct(ctx context.Context, args []string, cloudConfig []byte, cs cred.Store) ([]byte, error) {
+	lo.G.Debug("calling RPC client GetProduct")
+	id, err := p.serveCredStore(cs)
+	if err != nil {
+		return nil, err
+	}
+	return p.getProduct(ctx, args, cloudConfig, id)
+}
+
+// getProduct calls GetProduct with the cred store already served under id.
+func (p *RPC) getProduct(ctx context.Context, args []string, cloudConfig []byte, id uint32) ([]byte, error) {
+	var resp Response
+	call := p.newCall(ctx)
+	err := p.call(ctx, "Plugin.GetProduct", call, Args{
+		Call:        call,
+		Args:        args,
+		CloudConfig: cloudConfig,
+		CredStoreID: id,
+	}, &resp)
+	if err != nil {
+		return nil, err
+	}
+	if err = perr.FromReply(resp.Err, resp.ErrRes); err != nil {
+		lo.G.Debug("error:", err)
+		return nil, err
+	}
+	return resp.Bytes, nil
+}
+
+// GetManifest calls a plugin's GetManifest method over RPC.  Plugins
+// that do not implement ManifestDeployer return their GetProduct result
+// with no side data.
+func (p *RPC) GetManifest(ctx context.Context, args []string, cloudConfig []byte, cs cred.Store) (*Manifest, error) {
+	id, err := p.serveCredStore(cs)
+	if err != nil {
+		return nil, err
+	}
+	return p.getManifest(ctx, args, cloudConfig, id)
+}
+
+// manifestAndProduct is like GetManifest, but also returns the bytes the
+// plugin sent, which are its GetProduct result if it predates GetManifest.
+func (p *RPC) manifestAndProduct(ctx context.Context, args []string, cloudConfig []byte, cs cred.Store) (*Manifest, []byte, error) {
+	id, err := p.serveCredStore(cs)
+	if err != nil {
+		return nil, nil, err
+	}
+	return p.getManifestBytes(ctx, args, cloudConfig, id)
+}
+
+// getManifest calls GetManifest with the cred store already served under
+// id.
+func (p *RPC) getManifest(ctx context.Context, args []string, cloudConfig []byte, id uint32) (*Manifest, error) {
+	m, _, err := p.getManifestBytes(ctx, args, cloudConfig, id)
+	return m, err
+}
+
+// getManifestBytes calls GetManifest with the cred store already served
+// under id, returning the manifest as sent along with the parsed one.  A
+// plugin without the method never connects to the cred store, so the
+// fallback call reuses id.
+func (p *RPC) getManifestBytes(ctx context.Context, args []string, cloudConfig []byte, id uint32) (*Manifest, []byte, error) {
+	var resp ManifestResponse
+	call := p.newCall(ctx)
+	err := p.call(ctx, "Plugin.GetManifest", call, Args{
+		Call:        call,
+		Args:        args,
+		CloudConfig: cloudConfig,
+		CredStoreID: id,
+	}, &resp)
+	if missingMethod(err) {
+		// the plugin predates GetManifest
+		b, err := p.getProduct(ctx, args, cloudConfig, id)
+		if err != nil {
+			return nil, nil, err
+		}
+		m, err := NewManifest(b)
+		return m, b, err
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = perr.FromReply(resp.Err, resp.ErrRes); err != nil {
+		return nil, nil, err
+	}
+	m, err := NewManifest(resp.Manifest)
+	if err != nil {
+		return nil, nil, err
+	}
+	m.Variables = resp.Variables
+	m.Releases = resp.Releases
+	m.Warnings = resp.Warnings
+	return m, resp.Manifest, nil
+}
+
+// GetDeployments calls a plugin's GetDeployments method over RPC.
+// Plugins that do not implement CompositeDeployer return their manifest
+// as a single deployment.
+func (p *RPC) GetDeployments(ctx context.Context, args []string, cloudConfig []byte, cs cred.Store) ([]Deployment, error) {
+	id, err := p.serveCredStore(cs)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp DeploymentsResponse
+	call := p.newCall(ctx)
+	err = p.call(ctx, "Plugin.GetDeployments", call, Args{
+		Call:        call,
+		Args:        args,
+		CloudConfig: cloudConfig,
+		CredStoreID: id,
+	}, &resp)
+	if missingMethod(err) {
+		// the plugin predates GetDeployments, and like getManifest
+		// the fallback reuses the cred store's id
+		return single(p.getManifest(ctx, args, cloudConfig, id))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = perr.FromReply(resp.Err, resp.ErrRes); err != nil {
+		return nil, err
+	}
+	var deployments []Deployment
+	for _, d := range resp.Deployments {
+		m, err := NewManifest(d.Manifest)
+		if err != nil {
+			return nil, fmt.Errorf("product: deployment %s: %v", d.Name, err)
+		}
+		m.Variables = d.Variables
+		m.Releases = d.Releases
+		m.Warnings = d.Warnings
+		deployments = append(deployments, Deployment{Name: d.Name, Manifest: m, DependsOn: d.DependsOn})
+	}
+	return deployments, nil
+}
+
+// GetMeta calls a plugin's GetMeta method over RPC.
+func (p *RPC) GetMeta(ctx context.Context) (Meta, error) {
+	var resp MetaResponse
+	call := p.newCall(ctx)
+	if err := p.call(ctx, "Plugin.GetMeta", call, call, &resp); err != nil {
+		return Meta{}, err
+	}
+	if err := perr.FromReply(resp.Err, resp.ErrRes); err != nil {
+		return Meta{}, err
+	}
+	return resp.Meta, nil
+}
+
+// GetFlags calls a plugin's GetFlags method over RPC.
+func (p *RPC) GetFlags(ctx context.Context) ([]pcli.Flag, error) {
+	var resp FlagsResponse
+	call := p.newCall(ctx)
+	if err := p.call(ctx, "Plugin.GetFlags", call, call, &resp); err != nil {
+		return nil, err
+	}
+	if err := perr.FromReply(resp.Err, resp.ErrRes); err != nil {
+		return nil, err
+	}
+	return resp.Flags, nil
+}
+
+// serveCredStore serves cs to the plugin and returns the ID of the
+// connection it is served on, or zero if cs is nil.
+func (p *RPC) serveCredStore(cs cred.Store) (uint32, error) {
+	if cs == nil {
+		return 0, nil
+	}
+	if p.broker == nil {
+		return 0, errors.New("product: cannot pass a cred store without a connection broker")
+	}
+	id := p.broker.NextId()
+	go p.broker.AcceptAndServe(id, &cred.RPCServer{Impl: cs})
+	return id, nil
+}
+
+func (p *RPC) newCall(ctx context.Context) Call {
+	deadline, _ := ctx.Deadline()
+	return Call{
+		ID:       atomic.AddUint64(&p.nextID, 1),
+		Deadline: deadline,
+	}
+}
+
+// call makes an RPC call, cancelling it in the plugin if ctx is done first.
+// resp must not be read unless call returns nil.
+func (p *RPC) call(ctx context.Context, method string, c Call, args, resp interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	rc := p.client.Go(method, args, resp, make(chan *rpc.Call, 1))
+	select {
+	case <-rc.Done:
+		// the plugin may have seen the deadline pass before the host's
+		// timer fired
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if deadline, ok := ctx.Deadline(); ok && !time.Now().Before(deadline) {
+			return context.DeadlineExceeded
+		}
+		return perr.FromRPC(method, rc.Error)
+	case <-ctx.Done():
+		// the plugin's reply, if any, is discarded
+		p.client.Go("Plugin.Cancel", c.ID, new(interface{}), make(chan *rpc.Call, 1))
+		return ctx.Err()
+	}
+}
+
+// RPCServer is the RPC server that RPC connects to.
+// It conforms to the requirements of net/rpc.
+type RPCServer struct {
+	Impl Deployer
+
+	broker *plugin.MuxBroker
+
+	mu        sync.Mutex
+	cancels   map[uint64]context.CancelFunc
+	cancelled map[uint64]bool // cancellations of calls not running
+	order     []uint64        // IDs in cancelled, oldest first
+}
+
+// maxCancelled is how many cancellations of calls that are not running
+// the server remembers.  Such a cancellation either overtook its call or
+// arrived after the call finished, and the server cannot tell which, so
+// the oldest are forgotten first.
+const maxCancelled = 64
+
+// GetProduct forwards the RPC request to the plugin's GetProduct method
+// and sends back the results.
+func (s *RPCServer) GetProduct(args Args, resp *Response) error {
+	cs, closeStore, err := s.credStore(args.CredStoreID)
+	if err != nil {
+		return err
+	}
+	defer closeStore()
+
+	ctx, done := s.context(args.Call)
+	defer done()
+	resp.Bytes, err = s.Impl.GetProduct(ctx, args.Args, args.CloudConfig, cs)
+	resp.ErrRes, resp.Err = errString(err), perr.Envelope(err)
+	return nil
+}
+
+// GetManifest forwards the RPC request to the plugin's GetManifest
+// method, or to GetProduct if the plugin is not a ManifestDeployer,
+// and sends back the results.
+func (s *RPCServer) GetManifest(args Args, resp *ManifestResponse) error {
+	cs, closeStore, err := s.credStore(args.CredStoreID)
+	if err != nil {
+		return err
+	}
+	defer closeStore()
+
+	ctx, done := s.context(args.Call)
+	defer done()
+	md, ok := s.Impl.(ManifestDeployer)
+	if !ok {
+		resp.Manifest, err = s.Impl.GetProduct(ctx, args.Args, args.CloudConfig, cs)
+		resp.ErrRes, resp.Err = errString(err), perr.Envelope(err)
+		return nil
+	}
+	m, err := md.GetManifest(ctx, args.Args, args.CloudConfig, cs)
+	if err == nil && m != nil {
+		resp.Manifest = m.Bytes()
+		resp.Variables = m.Variables
+		resp.Releases = m.Releases
+		resp.Warnings = m.Warnings
+	}
+	resp.ErrRes, resp.Err = errString(err), perr.Envelope(err)
+	return nil
+}
+
+// GetDeployments forwards the RPC request to the plugin's GetDeployments
+// method, or returns the plugin's manifest as a single deployment if it
+// is not a CompositeDeployer, and sends back the results.
+func (s *RPCServer) GetDeployments(args Args, resp *DeploymentsResponse) error {
+	cs, closeStore, err := s.credStore(args.CredStoreID)
+	if err != nil {
+		return err
+	}
+	defer closeStore()
+
+	ctx, done := s.context(args.Call)
+	defer done()
+	deployments, err := GetDeployments(ctx, s.Impl, args.Args, args.CloudConfig, cs)
+	if err == nil {
+		for _, d := range deployments {
+			dr := DeploymentResponse{Name: d.Name, DependsOn: d.DependsOn}
+			if d.Manifest != nil {
+				dr.Manifest = d.Manifest.Bytes()
+				dr.Variables = d.Manifest.Variables
+				dr.Releases = d.Manifest.Releases
+				dr.Warnings = d.Manifest.Warnings
+			}
+			resp.Deployments = append(resp.Deployments, dr)
+		}
+	}
+	resp.ErrRes, resp.Err = errString(err), perr.Envelope(err)
+	return nil
+}
+
+// credStore connects to the cred store the host serves on the connection
+// with the given ID.  It returns a nil store if id is zero.
+func (s *RPCServer) credStore(id uint32) (cs cred.Store, closeStore func(), err error) {
+	if id == 0 {
+		return nil, func() {}, nil
+	}
+	if s.broker == nil {
+		return nil, nil, errors.New("product: cannot reach the host's cred store without a connection broker")
+	}
+	conn, err := s.broker.Dial(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	client := rpc.NewClient(conn)
+	return cred.NewRPC(client), func() { client.Close() }, nil
+}
+
+// GetMeta forwards the RPC request to the plugin's GetMeta method
+// and sends back the results.
+func (s *RPCServer) GetMeta(c Call, resp *MetaResponse) error {
+	ctx, done := s.context(c)
+	defer done()
+	var err error
+	resp.Meta, err = s.Impl.GetMeta(ctx)
+	resp.ErrRes, resp.Err = errString(err), perr.Envelope(err)
+	return nil
+}
+
+// GetFlags forwards the RPC request to the plugin's GetFlags method
+// and sends back the results.
+func (s *RPCServer) GetFlags(c Call, resp *FlagsResponse) error {
+	ctx, done := s.context(c)
+	defer done()
+	var err error
+	resp.Flags, err = s.Impl.GetFlags(ctx)
+	resp.ErrRes, resp.Err = errString(err), perr.Envelope(err)
+	return nil
+}
+
+// Cancel cancels the context of the call with the given ID.
+func (s *RPCServer) Cancel(id uint64, resp *interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if cancel, ok := s.cancels[id]; ok {
+		cancel()
+		return nil
+	}
+	if s.cancelled == nil {
+		s.cancelled = make(map[uint64]bool)
+	}
+	if !s.cancelled[id] {
+		s.cancelled[id] = true
+		s.order = append(s.order, id)
+		if len(s.order) > maxCancelled {
+			delete(s.cancelled, s.order[0])
+			s.order = s.order[1:]
+		}
+	}
+	return nil
+}
+
+// context returns the context for a call, which is cancelled when the
+// host cancels the call, when its deadline passes or when done is called.
+func (s *RPCServer) context(c Call) (ctx context.Context, done func()) {
+	var cancel context.CancelFunc
+	if c.Deadline.IsZero() {
+		ctx, cancel = context.WithCancel(context.Background())
+	} else {
+		ctx, cancel = context.WithDeadline(context.Background(), c.Deadline)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cancelled[c.ID] {
+		delete(s.cancelled, c.ID)
+		cancel()
+	} else {
+		if s.cancels == nil {
+			s.cancels = make(map[uint64]context.CancelFunc)
+		}
+		s.cancels[c.ID] = cancel
+	}
+	return ctx, func() {
+		s.mu.Lock()
+		delete(s.cancels, c.ID)
+		s.mu.Unlock()
+		cancel()
+	}
+}
+
+// missingMethod reports whether err is net/rpc's reply to a call to a
+// method the plugin does not have, because it was built before the
+// method was added.
+func missingMethod(err error) bool {
+	e, ok := err.(*perr.RemoteError)
+	return ok && strings.HasPrefix(e.Message, "rpc: can't find method")
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
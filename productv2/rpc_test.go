@@ -0,0 +1,169 @@
+package product_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/rpc"
+	"time"
+
+	"github.com/enaml-ops/pluginlib/cred"
+	"github.com/enaml-ops/pluginlib/pcli"
+	"github.com/enaml-ops/pluginlib/perr"
+	"github.com/enaml-ops/pluginlib/productv2"
+	"github.com/enaml-ops/pluginlib/productv2/productv2fakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// newFakeDeployer returns a fake product that succeeds.
+func newFakeDeployer() *productv2fakes.FakeDeployer {
+	d := new(productv2fakes.FakeDeployer)
+	d.GetProductReturns([]byte("manifest"), nil)
+	d.GetMetaReturns(product.Meta{Name: "fakemeta"}, nil)
+	d.GetFlagsReturns([]pcli.Flag{pcli.CreateBoolFlag("b", "dummy")}, nil)
+	return d
+}
+
+// failIfDone makes d fail GetMeta calls whose context is already done.
+func failIfDone(d *productv2fakes.FakeDeployer) {
+	d.GetMetaStub = func(ctx context.Context) (product.Meta, error) {
+		return product.Meta{Name: "fakemeta"}, ctx.Err()
+	}
+}
+
+var _ = Describe("productv2 RPC", func() {
+	var (
+		d      *productv2fakes.FakeDeployer
+		client *rpc.Client
+		p      product.Deployer
+	)
+
+	BeforeEach(func() {
+		d = newFakeDeployer()
+		server := rpc.NewServer()
+		raw, err := product.Plugin{Plugin: d}.Server(nil)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(server.RegisterName("Plugin", raw)).Should(Succeed())
+		serverConn, clientConn := net.Pipe()
+		go server.ServeConn(serverConn)
+		client = rpc.NewClient(clientConn)
+
+		raw, err = product.Plugin{}.Client(nil, client)
+		Ω(err).ShouldNot(HaveOccurred())
+		p = raw.(product.Deployer)
+	})
+
+	AfterEach(func() {
+		client.Close()
+	})
+
+	It("forwards calls to the plugin", func() {
+		b, err := p.GetProduct(context.Background(), []string{"product"}, nil, nil)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(string(b)).Should(Equal("manifest"))
+
+		meta, err := p.GetMeta(context.Background())
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(meta.Name).Should(Equal("fakemeta"))
+
+		flags, err := p.GetFlags(context.Background())
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(flags).Should(HaveLen(1))
+	})
+
+	It("returns the plugin's errors", func() {
+		d.GetProductReturns(nil, errors.New("missing flag"))
+		d.GetMetaReturns(product.Meta{}, errors.New("missing flag"))
+		_, err := p.GetProduct(context.Background(), nil, nil, nil)
+		Ω(err).Should(MatchError("missing flag"))
+		_, err = p.GetMeta(context.Background())
+		Ω(err).Should(MatchError("missing flag"))
+	})
+
+	It("returns the plugin's structured errors", func() {
+		sealed := perr.CredStore(errors.New("vault sealed"), true)
+		d.GetProductReturns(nil, sealed)
+		d.GetFlagsReturns(nil, sealed)
+		_, err := p.GetProduct(context.Background(), nil, nil, nil)
+		Ω(perr.CodeOf(err)).Should(Equal(perr.CodeCredStore))
+		Ω(perr.IsRetryable(err)).Should(BeTrue())
+		_, err = p.GetFlags(context.Background())
+		Ω(perr.CodeOf(err)).Should(Equal(perr.CodeCredStore))
+	})
+
+	It("passes the deadline to the plugin", func() {
+		deadline := time.Now().Add(time.Hour)
+		ctx, cancel := context.WithDeadline(context.Background(), deadline)
+		defer cancel()
+		_, err := p.GetMeta(ctx)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(d.GetMetaCallCount()).Should(Equal(1))
+		pluginDeadline, ok := d.GetMetaArgsForCall(0).Deadline()
+		Ω(ok).Should(BeTrue())
+		Ω(pluginDeadline).Should(BeTemporally("==", deadline))
+	})
+
+	It("cancels the call in the plugin when the context is cancelled", func() {
+		contexts := make(chan context.Context, 1)
+		d.GetProductStub = func(ctx context.Context, args []string, cloudConfig []byte, cs cred.Store) ([]byte, error) {
+			contexts <- ctx
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		errs := make(chan error, 1)
+		go func() {
+			_, err := p.GetProduct(ctx, nil, nil, nil)
+			errs <- err
+		}()
+
+		var pluginCtx context.Context
+		Eventually(contexts).Should(Receive(&pluginCtx))
+		Consistently(pluginCtx.Done()).ShouldNot(BeClosed())
+		cancel()
+		Eventually(errs).Should(Receive(Equal(context.Canceled)))
+		Eventually(pluginCtx.Done()).Should(BeClosed())
+	})
+
+	It("honours cancellations that overtake calls which started late", func() {
+		failIfDone(d)
+		s := &product.RPCServer{Impl: d}
+		var resp product.MetaResponse
+		Ω(s.Cancel(1, new(interface{}))).Should(Succeed())
+		// a later call finishing first must not forget the cancellation
+		Ω(s.GetMeta(product.Call{ID: 2}, &resp)).Should(Succeed())
+		Ω(resp.Err).Should(BeNil())
+
+		Ω(s.GetMeta(product.Call{ID: 1}, &resp)).Should(Succeed())
+		Ω(resp.ErrRes).Should(Equal(context.Canceled.Error()))
+	})
+
+	It("remembers only the most recent cancellations of calls that are not running", func() {
+		failIfDone(d)
+		s := &product.RPCServer{Impl: d}
+		for id := uint64(1); id <= 65; id++ {
+			Ω(s.Cancel(id, new(interface{}))).Should(Succeed())
+		}
+		var resp product.MetaResponse
+		Ω(s.GetMeta(product.Call{ID: 1}, &resp)).Should(Succeed())
+		Ω(resp.Err).Should(BeNil())
+		Ω(s.GetMeta(product.Call{ID: 65}, &resp)).Should(Succeed())
+		Ω(resp.ErrRes).Should(Equal(context.Canceled.Error()))
+	})
+
+	It("does not call the plugin when the context is already done", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := p.GetFlags(ctx)
+		Ω(err).Should(Equal(context.Canceled))
+		Consistently(d.GetFlagsCallCount).Should(BeZero())
+	})
+
+	It("returns a transport error when the plugin cannot be reached", func() {
+		client.Close()
+		_, err := p.GetMeta(context.Background())
+		Ω(perr.IsTransport(err)).Should(BeTrue())
+	})
+})
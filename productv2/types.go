@@ -0,0 +1,136 @@
+// Package product is the API for the V2 product interface.
+//
+// V2 product plugins take a context.Context in every call.  The context's
+// deadline and cancellation are carried across the RPC boundary, so a
+// plugin sees ctx.Done() when the host gives up on a call.
+//
+// Plugins may also implement ManifestDeployer to return a typed manifest
+// that hosts can inspect and change without parsing YAML, and products
+// made of several deployments implement CompositeDeployer.  Hosts roll
+// those out with a Plan.
+package product
+
+import (
+	"context"
+
+	"github.com/enaml-ops/pluginlib/cred"
+	"github.com/enaml-ops/pluginlib/pcli"
+	v1 "github.com/enaml-ops/pluginlib/productv1"
+	"github.com/xchapter7x/lo"
+)
+
+// Meta is the metadata for a product plugin.  It has the same fields as
+// the V1 Meta and can be converted to and from it.
+type Meta v1.Meta
+
+// Deployer is the interface implemented by V2 product plugins.
+type Deployer interface {
+	GetProduct(ctx context.Context, args []string, cloudConfig []byte, cs cred.Store) ([]byte, error)
+	GetMeta(ctx context.Context) (Meta, error)
+	GetFlags(ctx context.Context) ([]pcli.Flag, error)
+}
+
+// FromV1 adapts a V1 Deployer to the V2 interface.
+// V1 plugins cannot be cancelled, so a call returns as soon as its
+// context is done but the V1 call carries on in the background.
+func FromV1(d v1.Deployer) Deployer {
+	return fromV1{d}
+}
+
+type fromV1 struct {
+	d v1.Deployer
+}
+
+func (a fromV1) GetProduct(ctx context.Context, args []string, cloudConfig []byte, cs cred.Store) ([]byte, error) {
+	var b []byte
+	err := wait(ctx, func() (err error) {
+		b, err = a.d.GetProduct(args, cloudConfig, cs)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (a fromV1) GetMeta(ctx context.Context) (Meta, error) {
+	var meta v1.Meta
+	err := wait(ctx, func() (err error) {
+		meta, err = v1.GetMetaE(a.d)
+		return
+	})
+	if err != nil {
+		return Meta{}, err
+	}
+	return Meta(meta), nil
+}
+
+func (a fromV1) GetFlags(ctx context.Context) ([]pcli.Flag, error) {
+	var flags []pcli.Flag
+	err := wait(ctx, func() (err error) {
+		flags, err = v1.GetFlagsE(a.d)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	return flags, nil
+}
+
+// wait runs f and returns its error, or ctx.Err() if ctx is done first.
+// f's results must not be read unless wait returns nil.
+func wait(ctx context.Context, f func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- f()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// AsV1 adapts a V2 Deployer to the V1 interface, so that hosts written
+// for V1 plugins can use it.  Calls are made with context.Background().
+// The result also implements v1.DeployerE.
+func AsV1(d Deployer) v1.Deployer {
+	return asV1{d}
+}
+
+type asV1 struct {
+	d Deployer
+}
+
+func (a asV1) GetProduct(args []string, cloudConfig []byte, cs cred.Store) ([]byte, error) {
+	return a.d.GetProduct(context.Background(), args, cloudConfig, cs)
+}
+
+func (a asV1) GetMeta() v1.Meta {
+	meta, err := a.GetMetaE()
+	if err != nil {
+		lo.G.Error("GetMeta:", err)
+	}
+	return meta
+}
+
+func (a asV1) GetMetaE() (v1.Meta, error) {
+	meta, err := a.d.GetMeta(context.Background())
+	return v1.Meta(meta), err
+}
+
+func (a asV1) GetFlags() []pcli.Flag {
+	flags, err := a.GetFlagsE()
+	if err != nil {
+		lo.G.Error("GetFlags:", err)
+	}
+	return flags
+}
+
+func (a asV1) GetFlagsE() ([]pcli.Flag, error) {
+	return a.d.GetFlags(context.Background())
+}
@@ -0,0 +1,68 @@
+package product_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/enaml-ops/pluginlib/cred"
+	v1 "github.com/enaml-ops/pluginlib/productv1"
+	"github.com/enaml-ops/pluginlib/productv1/productv1fakes"
+	"github.com/enaml-ops/pluginlib/productv2"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("V1 adapters", func() {
+	Context("when adapting a V1 Deployer", func() {
+		var d *productv1fakes.FakeDeployer
+
+		BeforeEach(func() {
+			d = new(productv1fakes.FakeDeployer)
+		})
+
+		It("forwards calls", func() {
+			d.GetMetaReturns(v1.Meta{Name: "fakemeta"})
+			d.GetProductReturns([]byte("manifest"), nil)
+			p := product.FromV1(d)
+
+			meta, err := p.GetMeta(context.Background())
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(meta.Name).Should(Equal("fakemeta"))
+			b, err := p.GetProduct(context.Background(), nil, nil, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(string(b)).Should(Equal("manifest"))
+		})
+
+		It("returns when the context is done even if the call is still running", func() {
+			release := make(chan struct{})
+			returned := make(chan struct{})
+			d.GetProductStub = func([]string, []byte, cred.Store) ([]byte, error) {
+				defer close(returned)
+				<-release
+				return []byte("late"), nil
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			b, err := product.FromV1(d).GetProduct(ctx, nil, nil, nil)
+			Ω(err).Should(Equal(context.DeadlineExceeded))
+			Ω(b).Should(BeNil())
+
+			// the late result must not be read by the adapter
+			close(release)
+			<-returned
+			time.Sleep(10 * time.Millisecond)
+		})
+	})
+
+	Context("when adapting a V2 Deployer to V1", func() {
+		It("forwards calls and reports errors through DeployerE", func() {
+			d := newFakeDeployer()
+			p := product.AsV1(d)
+			Ω(p.GetMeta().Name).Should(Equal("fakemeta"))
+			Ω(p.GetProduct(nil, nil, nil)).Should(Equal([]byte("manifest")))
+
+			_, ok := p.(v1.DeployerE)
+			Ω(ok).Should(BeTrue())
+		})
+	})
+})
@@ -0,0 +1,119 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/enaml-ops/pluginlib/pcli"
+)
+
+var errCallTimeout = errors.New("registry: timed out waiting for plugin to respond")
+
+// RegisterOptions controls how plugins are started during registration.
+type RegisterOptions struct {
+	// Workers is the maximum number of plugins started at once.
+	// It defaults to the number of CPUs.
+	Workers int
+
+	// StartTimeout is how long each plugin process has to start.
+	// It defaults to the go-plugin default of one minute.
+	StartTimeout time.Duration
+
+	// RPCTimeout is how long each plugin has to answer its
+	// GetMeta and GetFlags calls.  Zero means wait forever.
+	RPCTimeout time.Duration
+}
+
+// Result is the outcome of registering a single plugin.
+type Result struct {
+	Path   string
+	Record Record
+	Flags  []pcli.Flag
+	Err    error
+}
+
+// RegisterProducts registers the product plugins at the given paths in
+// parallel.  The results are returned in the same order as paths.
+// A plugin that fails, hangs or times out does not affect the others.
+func (r *Registry) RegisterProducts(paths []string, opts RegisterOptions) []Result {
+	return registerAll(paths, opts, r.registerProduct)
+}
+
+// RegisterCloudConfigs registers the cloud config plugins at the given
+// paths in parallel.  The results are returned in the same order as paths.
+// A plugin that fails, hangs or times out does not affect the others.
+func (r *Registry) RegisterCloudConfigs(paths []string, opts RegisterOptions) []Result {
+	return registerAll(paths, opts, r.registerCloudConfig)
+}
+
+// RegisterProducts registers product plugins in parallel in the default registry.
+func RegisterProducts(paths []string, opts RegisterOptions) []Result {
+	return defaultRegistry.RegisterProducts(paths, opts)
+}
+
+// RegisterCloudConfigs registers cloud config plugins in parallel in the default registry.
+func RegisterCloudConfigs(paths []string, opts RegisterOptions) []Result {
+	return defaultRegistry.RegisterCloudConfigs(paths, opts)
+}
+
+type registerFunc func(pluginpath string, opts RegisterOptions) (Record, []pcli.Flag, error)
+
+func registerAll(paths []string, opts RegisterOptions, register registerFunc) []Result {
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	results := make([]Result, len(paths))
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	for i, pluginpath := range paths {
+		wg.Add(1)
+		go func(i int, pluginpath string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			record, flags, err := register(pluginpath, opts)
+			results[i] = Result{
+				Path:   pluginpath,
+				Record: record,
+				Flags:  flags,
+				Err:    err,
+			}
+		}(i, pluginpath)
+	}
+	wg.Wait()
+	return results
+}
+
+// callWithTimeout runs f and waits up to timeout for it to finish.
+// A zero timeout waits forever.  The v1 RPC clients may panic when the
+// plugin goes away, so panics in f are returned as errors.
+func callWithTimeout(timeout time.Duration, f func()) error {
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				done <- fmt.Errorf("registry: plugin call failed: %v", p)
+			}
+		}()
+		f()
+		done <- nil
+	}()
+
+	if timeout <= 0 {
+		return <-done
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		return errCallTimeout
+	}
+}
@@ -0,0 +1,78 @@
+package registry_test
+
+import (
+	"runtime"
+	"testing"
+	"time"
+
+	. "github.com/enaml-ops/pluginlib/registry"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("bulk registration", func() {
+	const (
+		productPath     = "./fixtures/product/testproductplugin-" + runtime.GOOS
+		cloudConfigPath = "./fixtures/cloudconfig/testplugin-" + runtime.GOOS
+		missingPath     = "./fixtures/product/does-not-exist"
+	)
+
+	var reg *Registry
+
+	BeforeEach(func() {
+		if testing.Short() {
+			Skip("plugin registry tests skipped in short mode")
+		}
+		reg = New()
+	})
+
+	Context("when RegisterProducts is called w/ good and bad plugins", func() {
+		var results []Result
+
+		BeforeEach(func() {
+			results = reg.RegisterProducts([]string{productPath, missingPath, productPath}, RegisterOptions{Workers: 2})
+		})
+
+		It("then it should return a result for each path in order", func() {
+			Ω(results).Should(HaveLen(3))
+			Ω(results[0].Path).Should(Equal(productPath))
+			Ω(results[1].Path).Should(Equal(missingPath))
+			Ω(results[2].Path).Should(Equal(productPath))
+		})
+
+		It("then it should register the good plugins", func() {
+			Ω(results[0].Err).ShouldNot(HaveOccurred())
+			Ω(results[0].Record.Name).Should(Equal("myfakeproduct"))
+			Ω(results[2].Err).ShouldNot(HaveOccurred())
+			Ω(reg.ListProducts()).Should(HaveKey("myfakeproduct"))
+		})
+
+		It("then it should report the bad plugins", func() {
+			Ω(IsPluginError(results[1].Err, ErrMissingBinary)).Should(BeTrue())
+		})
+	})
+
+	Context("when RegisterCloudConfigs is called", func() {
+		It("then it should register the cloud config plugins", func() {
+			results := reg.RegisterCloudConfigs([]string{cloudConfigPath}, RegisterOptions{})
+			Ω(results).Should(HaveLen(1))
+			Ω(results[0].Err).ShouldNot(HaveOccurred())
+			Ω(reg.ListCloudConfigs()).Should(HaveKey("myfakecloudconfig"))
+		})
+	})
+
+	Context("when a plugin does not respond within the RPC timeout", func() {
+		It("then it should return a timeout error", func() {
+			results := reg.RegisterProducts([]string{productPath}, RegisterOptions{RPCTimeout: time.Nanosecond})
+			Ω(IsPluginError(results[0].Err, ErrTimeout)).Should(BeTrue())
+			Ω(reg.ListProducts()).Should(BeEmpty())
+		})
+	})
+
+	Context("when a plugin does not start within the start timeout", func() {
+		It("then it should return a timeout error", func() {
+			results := reg.RegisterProducts([]string{productPath}, RegisterOptions{StartTimeout: time.Nanosecond})
+			Ω(IsPluginError(results[0].Err, ErrTimeout)).Should(BeTrue())
+		})
+	})
+})
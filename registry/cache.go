@@ -0,0 +1,178 @@
+package registry
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/enaml-ops/pluginlib/pcli"
+	"github.com/xchapter7x/lo"
+)
+
+const (
+	productType     = "product"
+	cloudConfigType = "cloudconfig"
+)
+
+// Cache is an on-disk store of plugin records and flags.
+// Entries are keyed by the plugin binary's path and are only used while
+// the binary's size and SHA-256 checksum are unchanged, so plugins that
+// have not changed can be registered without spawning a process.
+type Cache struct {
+	filename string
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+// cacheVersion is the format of the entries written by this version of
+// the registry.  Entries in other formats are ignored, as their records
+// may be missing fields.
+const cacheVersion = 2
+
+type cacheEntry struct {
+	Version int         `json:"version"`
+	Type    string      `json:"type"`
+	Size    int64       `json:"size"`
+	SHA256  string      `json:"sha256"`
+	Record  Record      `json:"record"`
+	Flags   []pcli.Flag `json:"flags"`
+	// Protocol is the protocol version the plugin spoke, if known.
+	Protocol uint `json:"protocol,omitempty"`
+}
+
+// OpenCache loads the cache stored in filename.
+// A missing file results in an empty cache which is created
+// the first time a plugin is stored.
+func OpenCache(filename string) (*Cache, error) {
+	c := &Cache{
+		filename: filename,
+		entries:  make(map[string]cacheEntry),
+	}
+	b, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(b, &c.entries); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Save writes the cache to disk.
+func (c *Cache) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.save()
+}
+
+func (c *Cache) save() error {
+	b, err := json.MarshalIndent(c.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := c.filename + ".tmp"
+	if err = ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.filename)
+}
+
+// kind returns the plugin type cached for pluginpath, if the
+// cached entry is still valid.
+func (c *Cache) kind(pluginpath string) string {
+	entry, ok := c.get(pluginpath)
+	if !ok {
+		return ""
+	}
+	return entry.Type
+}
+
+// lookup returns the cached entry for the plugin at pluginpath if
+// it exists and the binary has not changed.
+func (c *Cache) lookup(pluginpath, typ string) (cacheEntry, bool) {
+	entry, ok := c.get(pluginpath)
+	if !ok || entry.Type != typ {
+		return cacheEntry{}, false
+	}
+	lo.G.Debugf("registry: using cached %s plugin %s", typ, pluginpath)
+	return entry, true
+}
+
+func (c *Cache) get(pluginpath string) (cacheEntry, bool) {
+	if c == nil {
+		return cacheEntry{}, false
+	}
+	key, err := filepath.Abs(pluginpath)
+	if err != nil {
+		return cacheEntry{}, false
+	}
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	c.mu.Unlock()
+	if !ok || entry.Version != cacheVersion {
+		return cacheEntry{}, false
+	}
+	size, sum, err := checksum(pluginpath)
+	if err != nil || size != entry.Size || sum != entry.SHA256 {
+		return cacheEntry{}, false
+	}
+	return entry, true
+}
+
+// store records the plugin at pluginpath and writes the cache to disk.
+// Failures are logged and otherwise ignored, as the cache is only an
+// optimization.
+func (c *Cache) store(pluginpath, typ string, record Record, flags []pcli.Flag, protocol uint) {
+	if c == nil {
+		return
+	}
+	key, err := filepath.Abs(pluginpath)
+	if err != nil {
+		lo.G.Debug("registry: not caching plugin:", err)
+		return
+	}
+	size, sum, err := checksum(pluginpath)
+	if err != nil {
+		lo.G.Debug("registry: not caching plugin:", err)
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = cacheEntry{
+		Version:  cacheVersion,
+		Type:     typ,
+		Size:     size,
+		SHA256:   sum,
+		Record:   record,
+		Flags:    flags,
+		Protocol: protocol,
+	}
+	if err = c.save(); err != nil {
+		lo.G.Debug("registry: failed to save cache:", err)
+	}
+}
+
+// checksum returns the size and hex-encoded SHA-256 of the named file.
+func checksum(name string) (int64, string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return 0, "", err
+	}
+	return size, hex.EncodeToString(h.Sum(nil)), nil
+}
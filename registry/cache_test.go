@@ -0,0 +1,101 @@
+package registry_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	. "github.com/enaml-ops/pluginlib/registry"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Cache", func() {
+	var (
+		dir       string
+		cacheFile string
+		reg       *Registry
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "registry-cache")
+		Ω(err).ShouldNot(HaveOccurred())
+		cacheFile = filepath.Join(dir, "cache.json")
+		reg = New()
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	Context("when the cache file does not exist", func() {
+		It("then it should open an empty cache", func() {
+			c, err := OpenCache(cacheFile)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(c).ShouldNot(BeNil())
+		})
+	})
+
+	Context("when the cache file is not valid", func() {
+		It("then it should return an error", func() {
+			Ω(ioutil.WriteFile(cacheFile, []byte("not json"), 0644)).Should(Succeed())
+			_, err := OpenCache(cacheFile)
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+
+	Context("when a plugin is registered w/ a cache", func() {
+		const pluginpath = "./fixtures/product/testproductplugin-" + runtime.GOOS
+
+		BeforeEach(func() {
+			if testing.Short() {
+				Skip("plugin registry tests skipped in short mode")
+			}
+			c, err := OpenCache(cacheFile)
+			Ω(err).ShouldNot(HaveOccurred())
+			reg.UseCache(c)
+			_, err = reg.RegisterProduct(pluginpath)
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("then it should write the plugin's record to the cache file", func() {
+			b, err := ioutil.ReadFile(cacheFile)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(string(b)).Should(ContainSubstring("myfakeproduct"))
+			Ω(string(b)).Should(ContainSubstring("sha256"))
+		})
+
+		It("then it should use the cached record while the binary is unchanged", func() {
+			b, err := ioutil.ReadFile(cacheFile)
+			Ω(err).ShouldNot(HaveOccurred())
+			b = []byte(strings.Replace(string(b), `"Properties": null`, `"Properties": {"cached": true}`, -1))
+			Ω(ioutil.WriteFile(cacheFile, b, 0644)).Should(Succeed())
+
+			c, err := OpenCache(cacheFile)
+			Ω(err).ShouldNot(HaveOccurred())
+			reg.UseCache(c)
+			_, err = reg.RegisterProduct(pluginpath)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(reg.ListProducts()["myfakeproduct"].Properties).Should(HaveKeyWithValue("cached", true))
+		})
+
+		It("then it should ignore entries written by an older version", func() {
+			b, err := ioutil.ReadFile(cacheFile)
+			Ω(err).ShouldNot(HaveOccurred())
+			b = []byte(strings.Replace(string(b), `"Properties": null`, `"Properties": {"cached": true}`, -1))
+			b = []byte(strings.Replace(string(b), `"version": 2,`, ``, -1))
+			Ω(ioutil.WriteFile(cacheFile, b, 0644)).Should(Succeed())
+
+			c, err := OpenCache(cacheFile)
+			Ω(err).ShouldNot(HaveOccurred())
+			reg.UseCache(c)
+			_, err = reg.RegisterProduct(pluginpath)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(reg.ListProducts()["myfakeproduct"].Properties).ShouldNot(HaveKey("cached"))
+		})
+	})
+})
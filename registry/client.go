@@ -0,0 +1,225 @@
+package registry
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/enaml-ops/pluginlib/cloudconfigv1"
+	"github.com/enaml-ops/pluginlib/productv1"
+	productv2 "github.com/enaml-ops/pluginlib/productv2"
+	"github.com/hashicorp/go-plugin"
+	"github.com/xchapter7x/lo"
+)
+
+// GetProductReference starts the product plugin at pluginpath and returns
+// the running client along with the dispensed Deployer.
+// The caller is responsible for killing the client.
+// A *PluginError is returned if the plugin cannot be loaded.
+func (r *Registry) GetProductReference(pluginpath string) (*plugin.Client, product.Deployer, error) {
+	return r.getProductReference(pluginpath, 0)
+}
+
+func (r *Registry) getProductReference(pluginpath string, startTimeout time.Duration) (*plugin.Client, product.Deployer, error) {
+	client, raw, err := r.newClient(pluginpath, productProtocols, startTimeout)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch deployer := raw.(type) {
+	case product.Deployer:
+		return client, deployer, nil
+	case productv2.Deployer:
+		return client, productv2.AsV1(deployer), nil
+	}
+	client.Kill()
+	return nil, nil, &PluginError{Path: pluginpath, Kind: ErrDispense, Err: fmt.Errorf("unexpected plugin type %T", raw)}
+}
+
+// GetProductReferenceV2 is like GetProductReference but returns the V2
+// interface, whose calls take a context.  V1 plugins are adapted to it.
+func (r *Registry) GetProductReferenceV2(pluginpath string) (*plugin.Client, productv2.Deployer, error) {
+	client, raw, err := r.newClient(pluginpath, productProtocols, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch deployer := raw.(type) {
+	case productv2.Deployer:
+		return client, deployer, nil
+	case product.Deployer:
+		return client, productv2.FromV1(deployer), nil
+	}
+	client.Kill()
+	return nil, nil, &PluginError{Path: pluginpath, Kind: ErrDispense, Err: fmt.Errorf("unexpected plugin type %T", raw)}
+}
+
+// GetCloudConfigReference starts the cloud config plugin at pluginpath and
+// returns the running client along with the dispensed Deployer.
+// The caller is responsible for killing the client.
+// A *PluginError is returned if the plugin cannot be loaded.
+func (r *Registry) GetCloudConfigReference(pluginpath string) (*plugin.Client, cloudconfig.Deployer, error) {
+	return r.getCloudConfigReference(pluginpath, 0)
+}
+
+func (r *Registry) getCloudConfigReference(pluginpath string, startTimeout time.Duration) (*plugin.Client, cloudconfig.Deployer, error) {
+	client, raw, err := r.newClient(pluginpath, cloudConfigProtocols, startTimeout)
+	if err != nil {
+		return nil, nil, err
+	}
+	deployer, ok := raw.(cloudconfig.Deployer)
+	if !ok {
+		client.Kill()
+		return nil, nil, &PluginError{Path: pluginpath, Kind: ErrDispense, Err: fmt.Errorf("unexpected plugin type %T", raw)}
+	}
+	return client, deployer, nil
+}
+
+// defaultStartTimeout is how long go-plugin waits for a plugin to start
+// when no timeout is given.
+const defaultStartTimeout = time.Minute
+
+// newClient starts the plugin at pluginpath, or reattaches to it if it is
+// already running, and dispenses it using the newest of protocols that the
+// plugin speaks.  The client is killed if anything goes wrong.
+// A zero startTimeout uses the go-plugin default.
+func (r *Registry) newClient(pluginpath string, protocols []protocol, startTimeout time.Duration) (*plugin.Client, interface{}, error) {
+	reattach, err := r.reattachConfig(pluginpath)
+	if err != nil {
+		return nil, nil, &PluginError{Path: pluginpath, Kind: ErrStartup, Err: err}
+	}
+	if reattach != nil {
+		return r.reattachClient(pluginpath, protocols, reattach)
+	}
+
+	if _, err := os.Stat(pluginpath); err != nil {
+		return nil, nil, &PluginError{Path: pluginpath, Kind: ErrMissingBinary, Err: err}
+	}
+	exe, cleanup, err := r.verifiedCopy(pluginpath)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer cleanup()
+
+	client, raw, p, err := r.startClient(pluginpath, exe, protocols, startTimeout)
+	if err != nil {
+		return nil, nil, err
+	}
+	r.rememberProtocol(pluginpath, p.handshake.ProtocolVersion)
+	return client, raw, nil
+}
+
+// startClient runs exe, the binary of the plugin at pluginpath, and
+// dispenses it using the protocol it chose.
+func (r *Registry) startClient(pluginpath, exe string, protocols []protocol, startTimeout time.Duration) (*plugin.Client, interface{}, protocol, error) {
+	opts := r.processOptions()
+	sorted := newest(protocols)
+	cmd, err := command(exe, sorted[0].handshake, opts)
+	if err != nil {
+		return nil, nil, protocol{}, &PluginError{Path: pluginpath, Kind: ErrStartup, Err: err}
+	}
+	// separate writers, so that a partial line on one stream is not
+	// joined to a line from the other
+	stdout := r.newPluginWriter(pluginpath, cmd, 0)
+	stderr := r.newPluginWriter(pluginpath, cmd, 0)
+	config := &plugin.ClientConfig{
+		HandshakeConfig:  sorted[0].handshake,
+		VersionedPlugins: versionedPlugins(protocols),
+		Cmd:              cmd,
+		StartTimeout:     startTimeout,
+		Stderr:           stderr,
+		SyncStdout:       stdout,
+		SyncStderr:       stderr,
+	}
+	if config.StartTimeout == 0 {
+		config.StartTimeout = defaultStartTimeout
+	}
+	client := plugin.NewClient(config)
+
+	start := time.Now()
+	rpcClient, err := client.Client()
+	if err != nil {
+		lo.G.Debug("we got an error:", err)
+		client.Kill()
+		stdout.Close()
+		stderr.Close()
+		kind := classifyStartErr(cmd, time.Since(start), config.StartTimeout)
+		if kind == ErrHandshake {
+			err = fmt.Errorf("%v (host supports protocol versions %s)", err, protocolVersions(protocols))
+		}
+		return nil, nil, protocol{}, &PluginError{Path: pluginpath, Kind: kind, Err: err}
+	}
+	closeOnExit(client, stdout, stderr)
+
+	p, ok := find(protocols, uint(client.NegotiatedVersion()))
+	if !ok {
+		client.Kill()
+		return nil, nil, protocol{}, mismatch(pluginpath, uint(client.NegotiatedVersion()), protocols)
+	}
+	raw, err := rpcClient.Dispense(p.name)
+	if err != nil {
+		client.Kill()
+		return nil, nil, protocol{}, &PluginError{Path: pluginpath, Kind: ErrDispense, Err: err}
+	}
+	limitRuntime(client, opts.MaxRuntime)
+	return client, raw, p, nil
+}
+
+// reattachClient connects to the running plugin described by c.
+func (r *Registry) reattachClient(pluginpath string, protocols []protocol, c *ReattachConfig) (*plugin.Client, interface{}, error) {
+	reattach, err := c.resolve()
+	if err != nil {
+		return nil, nil, &PluginError{Path: pluginpath, Kind: ErrStartup, Err: err}
+	}
+	// nothing is exchanged when reattaching, so without a version assume
+	// the oldest, which every plugin predating protocol versions speaks
+	sorted := newest(protocols)
+	p := sorted[len(sorted)-1]
+	if c.ProtocolVersion != 0 {
+		var ok bool
+		if p, ok = find(protocols, c.ProtocolVersion); !ok {
+			return nil, nil, mismatch(pluginpath, c.ProtocolVersion, protocols)
+		}
+	}
+	stdout := r.newPluginWriter(pluginpath, nil, reattach.Pid)
+	stderr := r.newPluginWriter(pluginpath, nil, reattach.Pid)
+	client := plugin.NewClient(&plugin.ClientConfig{
+		HandshakeConfig: p.handshake,
+		Plugins:         plugin.PluginSet{p.name: p.plugin},
+		Reattach:        reattach,
+		SyncStdout:      stdout,
+		SyncStderr:      stderr,
+	})
+
+	rpcClient, err := client.Client()
+	if err != nil {
+		client.Kill()
+		stdout.Close()
+		stderr.Close()
+		return nil, nil, &PluginError{Path: pluginpath, Kind: ErrStartup, Err: err}
+	}
+	closeOnExit(client, stdout, stderr)
+
+	raw, err := rpcClient.Dispense(p.name)
+	if err != nil {
+		client.Kill()
+		return nil, nil, &PluginError{Path: pluginpath, Kind: ErrDispense, Err: err}
+	}
+	return client, raw, nil
+}
+
+// GetProductReference starts the product plugin at pluginpath using the
+// settings of the default registry.
+func GetProductReference(pluginpath string) (*plugin.Client, product.Deployer, error) {
+	return defaultRegistry.GetProductReference(pluginpath)
+}
+
+// GetCloudConfigReference starts the cloud config plugin at pluginpath
+// using the settings of the default registry.
+func GetCloudConfigReference(pluginpath string) (*plugin.Client, cloudconfig.Deployer, error) {
+	return defaultRegistry.GetCloudConfigReference(pluginpath)
+}
+
+// GetProductReferenceV2 starts the product plugin at pluginpath using the
+// settings of the default registry and returns the V2 interface.
+func GetProductReferenceV2(pluginpath string) (*plugin.Client, productv2.Deployer, error) {
+	return defaultRegistry.GetProductReferenceV2(pluginpath)
+}
@@ -0,0 +1,122 @@
+package registry
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+var errNotExecutable = errors.New("registry: not an executable file")
+
+// Report summarizes the results of a call to Discover.
+type Report struct {
+	Products     []Record
+	CloudConfigs []Record
+	Skipped      []Skipped
+}
+
+// Skipped describes a file or directory that Discover did not register.
+type Skipped struct {
+	Path   string
+	Reason error
+}
+
+// Discover scans each of the given directories for plugin executables,
+// detects whether each one is a product or a cloud config plugin, and
+// registers it accordingly.
+// Subdirectories are not scanned.  A plugin that fails to load is
+// recorded in the report's Skipped list and does not prevent the
+// remaining plugins from loading.
+func (r *Registry) Discover(dirs ...string) Report {
+	var report Report
+	for _, dir := range dirs {
+		infos, err := ioutil.ReadDir(dir)
+		if err != nil {
+			report.Skipped = append(report.Skipped, Skipped{Path: dir, Reason: err})
+			continue
+		}
+		for _, info := range infos {
+			if info.IsDir() {
+				continue
+			}
+			pluginpath := filepath.Join(dir, info.Name())
+			if isCompanion(info.Name()) && !isExecutable(info) {
+				continue
+			}
+			if !isExecutable(info) {
+				report.Skipped = append(report.Skipped, Skipped{Path: pluginpath, Reason: errNotExecutable})
+				continue
+			}
+			r.discover(&report, pluginpath)
+		}
+	}
+	return report
+}
+
+// discover detects the type of the plugin at pluginpath and registers it.
+// The product handshake is tried first, and the cloud config handshake
+// is tried if the plugin does not serve a product.
+// Plugins whose type is declared in a manifest or already cached skip
+// detection.
+func (r *Registry) discover(report *Report, pluginpath string) {
+	kind := r.getCache().kind(pluginpath)
+	if m, ok, err := readManifest(pluginpath); ok && err == nil {
+		kind = m.Type
+	}
+	if kind == cloudConfigType {
+		r.discoverCloudConfig(report, pluginpath)
+		return
+	}
+
+	record, _, err := r.registerProduct(pluginpath, RegisterOptions{})
+	if err == nil {
+		report.Products = append(report.Products, record)
+		return
+	}
+	if !IsPluginError(err, ErrDispense) && !IsPluginError(err, ErrHandshake) {
+		report.Skipped = append(report.Skipped, Skipped{Path: pluginpath, Reason: err})
+		return
+	}
+
+	r.discoverCloudConfig(report, pluginpath)
+}
+
+func (r *Registry) discoverCloudConfig(report *Report, pluginpath string) {
+	record, _, err := r.registerCloudConfig(pluginpath, RegisterOptions{})
+	if err != nil {
+		report.Skipped = append(report.Skipped, Skipped{Path: pluginpath, Reason: err})
+		return
+	}
+	report.CloudConfigs = append(report.CloudConfigs, record)
+}
+
+// Discover scans the given directories and registers the plugins it
+// finds in the default registry.
+func Discover(dirs ...string) Report {
+	return defaultRegistry.Discover(dirs...)
+}
+
+func isExecutable(info os.FileInfo) bool {
+	if runtime.GOOS == "windows" {
+		return strings.EqualFold(filepath.Ext(info.Name()), ".exe")
+	}
+	return info.Mode().IsRegular() && info.Mode().Perm()&0111 != 0
+}
+
+// isCompanion reports whether name is a manifest or signature shipped
+// next to a plugin, rather than a plugin itself.
+func isCompanion(name string) bool {
+	ext := filepath.Ext(name)
+	if ext == SignatureExt {
+		return true
+	}
+	for _, e := range ManifestExts {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
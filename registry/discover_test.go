@@ -0,0 +1,51 @@
+package registry_test
+
+import (
+	"testing"
+
+	. "github.com/enaml-ops/pluginlib/registry"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Discover", func() {
+	Context("when called w/ a directory that does not exist", func() {
+		It("then it should skip the directory and report why", func() {
+			report := Discover("./fixtures/does-not-exist")
+			Ω(report.Products).Should(BeEmpty())
+			Ω(report.CloudConfigs).Should(BeEmpty())
+			Ω(report.Skipped).Should(HaveLen(1))
+			Ω(report.Skipped[0].Path).Should(Equal("./fixtures/does-not-exist"))
+			Ω(report.Skipped[0].Reason).Should(HaveOccurred())
+		})
+	})
+
+	Context("when called w/ directories containing plugins", func() {
+		var report Report
+
+		BeforeEach(func() {
+			if testing.Short() {
+				Skip("plugin registry tests skipped in short mode")
+			}
+			report = Discover("./fixtures/product", "./fixtures/cloudconfig")
+		})
+
+		It("then it should register the product plugins it finds", func() {
+			Ω(report.Products).Should(HaveLen(1))
+			Ω(report.Products[0].Name).Should(Equal("myfakeproduct"))
+			Ω(ListProducts()).Should(HaveKey("myfakeproduct"))
+		})
+
+		It("then it should register the cloud config plugins it finds", func() {
+			Ω(report.CloudConfigs).Should(HaveLen(1))
+			Ω(report.CloudConfigs[0].Name).Should(Equal("myfakecloudconfig"))
+			Ω(ListCloudConfigs()).Should(HaveKey("myfakecloudconfig"))
+		})
+
+		It("then it should skip files that are not executable", func() {
+			for _, s := range report.Skipped {
+				Ω(s.Path).Should(HaveSuffix(".keep"))
+			}
+		})
+	})
+})
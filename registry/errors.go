@@ -0,0 +1,148 @@
+package registry
+
+import (
+	"fmt"
+	"os/exec"
+	"syscall"
+	"time"
+
+	"github.com/enaml-ops/pluginlib/perr"
+)
+
+// ErrorKind classifies the ways a plugin can fail to load.
+type ErrorKind int
+
+const (
+	// ErrStartup means the plugin process crashed or exited before
+	// the host could connect to it.
+	ErrStartup ErrorKind = iota
+	// ErrMissingBinary means there is no plugin executable at the given path.
+	ErrMissingBinary
+	// ErrHandshake means the plugin answered with a handshake the host
+	// does not understand, such as a protocol version it does not speak.
+	ErrHandshake
+	// ErrDispense means the plugin started but could not provide
+	// the requested plugin type.
+	ErrDispense
+	// ErrTimeout means the plugin did not start or respond in time.
+	ErrTimeout
+	// ErrVerification means the plugin binary failed checksum or
+	// signature verification and was not executed.
+	ErrVerification
+	// ErrTooOld means the plugin only speaks protocol versions older
+	// than any the host supports.
+	ErrTooOld
+	// ErrTooNew means the plugin only speaks protocol versions newer
+	// than any the host supports.
+	ErrTooNew
+	// ErrManifest means the manifest shipped next to the plugin could
+	// not be read or is invalid.
+	ErrManifest
+	// ErrTransport means a call to the plugin did not reach it or its
+	// reply was lost, usually because the plugin crashed.
+	ErrTransport
+	// ErrRemote means the plugin received a call but failed it.
+	ErrRemote
+	// ErrMeta means the metadata the plugin reported is malformed.
+	ErrMeta
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case ErrMissingBinary:
+		return "missing binary"
+	case ErrHandshake:
+		return "handshake mismatch"
+	case ErrDispense:
+		return "dispense failed"
+	case ErrTimeout:
+		return "timed out"
+	case ErrVerification:
+		return "verification failed"
+	case ErrTooOld:
+		return "plugin too old"
+	case ErrTooNew:
+		return "plugin too new"
+	case ErrManifest:
+		return "invalid manifest"
+	case ErrTransport:
+		return "transport failed"
+	case ErrRemote:
+		return "plugin failed"
+	case ErrMeta:
+		return "invalid metadata"
+	default:
+		return "startup failed"
+	}
+}
+
+// PluginError is returned when a plugin cannot be loaded.
+// It records which plugin failed and why, so that callers can
+// skip the plugin and keep going.
+type PluginError struct {
+	Path string
+	Kind ErrorKind
+	Err  error
+}
+
+func (e *PluginError) Error() string {
+	return fmt.Sprintf("registry: plugin %s: %s: %v", e.Path, e.Kind, e.Err)
+}
+
+// Cause returns the underlying error, so that perr can find the error a
+// plugin returned.
+func (e *PluginError) Cause() error {
+	return e.Err
+}
+
+// IsPluginError reports whether err is a PluginError of the given kind.
+func IsPluginError(err error, kind ErrorKind) bool {
+	perr, ok := err.(*PluginError)
+	return ok && perr.Kind == kind
+}
+
+// classifyStartErr works out why the plugin run by cmd failed to start,
+// given how long the start took and its timeout.  It must be called once
+// the plugin's client has been killed.  go-plugin kills a plugin whose
+// handshake it rejects, for instance because the plugin speaks none of the
+// host's protocol versions, while a plugin that fails to start exits by
+// itself.
+func classifyStartErr(cmd *exec.Cmd, elapsed, timeout time.Duration) ErrorKind {
+	if elapsed >= timeout {
+		return ErrTimeout
+	}
+	if cmd.ProcessState == nil {
+		return ErrStartup
+	}
+	if status, ok := cmd.ProcessState.Sys().(syscall.WaitStatus); ok && status.Signaled() && status.Signal() == syscall.SIGKILL {
+		return ErrHandshake
+	}
+	return ErrStartup
+}
+
+// classifyCallErr maps an error from calling a running plugin
+// to the kind of failure it represents.
+func classifyCallErr(err error) ErrorKind {
+	switch {
+	case err == errCallTimeout:
+		return ErrTimeout
+	case perr.IsTransport(err):
+		return ErrTransport
+	case perr.IsRemote(err):
+		return ErrRemote
+	}
+	return ErrStartup
+}
+
+// NotFoundError is returned when a requested plugin is not registered.
+type NotFoundError struct {
+	Name    string
+	Version string
+}
+
+func (e *NotFoundError) Error() string {
+	if e.Version == "" {
+		return fmt.Sprintf("registry: %s is not registered", e.Name)
+	}
+	return fmt.Sprintf("registry: %s version %s is not registered", e.Name, e.Version)
+}
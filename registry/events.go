@@ -0,0 +1,160 @@
+package registry
+
+import (
+	"sort"
+
+	"github.com/enaml-ops/pluginlib/pcli"
+)
+
+// EventType identifies a change to the registry.
+type EventType int
+
+const (
+	// Registered is sent when a plugin is added to the registry.
+	Registered EventType = iota
+	// Unregistered is sent when a plugin is removed from the registry.
+	Unregistered
+	// Refreshed is sent when a plugin's meta and flags are re-read.
+	Refreshed
+)
+
+func (t EventType) String() string {
+	switch t {
+	case Registered:
+		return "registered"
+	case Unregistered:
+		return "unregistered"
+	default:
+		return "refreshed"
+	}
+}
+
+// Event describes a change to a plugin in the registry.
+type Event struct {
+	Type   EventType
+	Record Record
+}
+
+// Subscribe calls f whenever a plugin is registered, unregistered or
+// refreshed, so that callers holding references to a plugin can drop
+// them.  f is called synchronously and must not block for long.
+// The returned function stops further calls to f.
+func (r *Registry) Subscribe(f func(Event)) (unsubscribe func()) {
+	r.subMu.Lock()
+	id := r.nextSubID
+	r.nextSubID++
+	r.subscribers[id] = f
+	r.subMu.Unlock()
+
+	return func() {
+		r.subMu.Lock()
+		delete(r.subscribers, id)
+		r.subMu.Unlock()
+	}
+}
+
+func (r *Registry) notify(e Event) {
+	r.subMu.Lock()
+	subs := make([]func(Event), 0, len(r.subscribers))
+	for _, f := range r.subscribers {
+		subs = append(subs, f)
+	}
+	r.subMu.Unlock()
+
+	for _, f := range subs {
+		f(e)
+	}
+}
+
+// Unregister removes every version of the named product, and the
+// cloud config plugin with that name, from the registry.
+func (r *Registry) Unregister(name string) error {
+	r.mu.Lock()
+	var removed []Record
+	for _, record := range r.products[name] {
+		removed = append(removed, record)
+	}
+	delete(r.products, name)
+	if record, ok := r.cloudconfigs[name]; ok {
+		removed = append(removed, record)
+		delete(r.cloudconfigs, name)
+	}
+	r.mu.Unlock()
+
+	if len(removed) == 0 {
+		return &NotFoundError{Name: name}
+	}
+	sort.Sort(byNameAndVersion(removed))
+	for _, record := range removed {
+		r.notify(Event{Type: Unregistered, Record: record.copy()})
+	}
+	return nil
+}
+
+// Refresh restarts every registered plugin with the given name and
+// re-reads its meta and flags, bypassing the cache, so that a new binary
+// installed at the same path is picked up.  A plugin that fails to load
+// is removed from the registry and its error is returned in its Result.
+func (r *Registry) Refresh(name string) ([]Result, error) {
+	r.mu.RLock()
+	var products []Record
+	for _, record := range r.products[name] {
+		products = append(products, record)
+	}
+	cc, hasCC := r.cloudconfigs[name]
+	r.mu.RUnlock()
+
+	if len(products) == 0 && !hasCC {
+		return nil, &NotFoundError{Name: name}
+	}
+	sort.Sort(byVersion(products))
+
+	var results []Result
+	for _, old := range products {
+		record, flags, err := r.loadProduct(old.Path, RegisterOptions{})
+		r.mu.Lock()
+		if versions, ok := r.products[old.Name]; ok {
+			delete(versions, old.Version)
+			if len(versions) == 0 {
+				delete(r.products, old.Name)
+			}
+		}
+		r.mu.Unlock()
+		if err == nil {
+			r.addProduct(record)
+		}
+		results = append(results, r.refreshed(old, record, flags, err))
+	}
+
+	if hasCC {
+		record, flags, err := r.loadCloudConfig(cc.Path, RegisterOptions{})
+		r.mu.Lock()
+		delete(r.cloudconfigs, cc.Name)
+		r.mu.Unlock()
+		if err == nil {
+			r.addCloudConfig(record)
+		}
+		results = append(results, r.refreshed(cc, record, flags, err))
+	}
+	return results, nil
+}
+
+// refreshed notifies subscribers of the outcome of refreshing old.
+func (r *Registry) refreshed(old, record Record, flags []pcli.Flag, err error) Result {
+	if err != nil {
+		r.notify(Event{Type: Unregistered, Record: old.copy()})
+		return Result{Path: old.Path, Err: err}
+	}
+	r.notify(Event{Type: Refreshed, Record: record.copy()})
+	return Result{Path: old.Path, Record: record.copy(), Flags: flags}
+}
+
+// Unregister removes the named plugin from the default registry.
+func Unregister(name string) error {
+	return defaultRegistry.Unregister(name)
+}
+
+// Refresh re-reads the named plugin in the default registry.
+func Refresh(name string) ([]Result, error) {
+	return defaultRegistry.Refresh(name)
+}
@@ -0,0 +1,148 @@
+package registry
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("registry events", func() {
+	var (
+		reg    *Registry
+		mu     sync.Mutex
+		events []Event
+	)
+
+	received := func() []Event {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]Event(nil), events...)
+	}
+
+	BeforeEach(func() {
+		reg = New()
+		events = nil
+		reg.Subscribe(func(e Event) {
+			mu.Lock()
+			events = append(events, e)
+			mu.Unlock()
+		})
+	})
+
+	Describe("Unregister", func() {
+		BeforeEach(func() {
+			reg.addProduct(Record{Name: "p-mysql", Version: "1.9.0"})
+			reg.addProduct(Record{Name: "p-mysql", Version: "1.10.0"})
+			reg.addProduct(Record{Name: "p-redis", Version: "1.7.2"})
+		})
+
+		It("removes every version of the named product", func() {
+			Ω(reg.Unregister("p-mysql")).Should(Succeed())
+			Ω(reg.ListProducts()).ShouldNot(HaveKey("p-mysql"))
+			Ω(reg.ListProducts()).Should(HaveKey("p-redis"))
+		})
+
+		It("notifies subscribers of each removed version", func() {
+			Ω(reg.Unregister("p-mysql")).Should(Succeed())
+			Ω(received()).Should(HaveLen(2))
+			for _, e := range received() {
+				Ω(e.Type).Should(Equal(Unregistered))
+				Ω(e.Record.Name).Should(Equal("p-mysql"))
+			}
+		})
+
+		It("returns an error for a plugin that is not registered", func() {
+			Ω(reg.Unregister("p-rabbitmq")).Should(BeAssignableToTypeOf(&NotFoundError{}))
+			Ω(received()).Should(BeEmpty())
+		})
+
+		It("stops notifying subscribers that unsubscribe", func() {
+			reg = New()
+			unsubscribe := reg.Subscribe(func(e Event) { Fail("unexpected event") })
+			unsubscribe()
+			reg.addProduct(Record{Name: "p-mysql"})
+			Ω(reg.Unregister("p-mysql")).Should(Succeed())
+		})
+	})
+
+	Describe("Refresh", func() {
+		var (
+			dir        string
+			pluginpath string
+		)
+
+		copyFile := func(src, dst string) {
+			b, err := ioutil.ReadFile(src)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(ioutil.WriteFile(dst, b, 0755)).Should(Succeed())
+		}
+
+		BeforeEach(func() {
+			if testing.Short() {
+				Skip("plugin registry tests skipped in short mode")
+			}
+			var err error
+			dir, err = ioutil.TempDir("", "registry-events")
+			Ω(err).ShouldNot(HaveOccurred())
+			pluginpath = filepath.Join(dir, "plugin")
+			copyFile("./fixtures/product/testproductplugin-"+runtime.GOOS, pluginpath)
+			_, err = reg.RegisterProduct(pluginpath)
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		It("re-reads the plugin's meta and flags", func() {
+			results, err := reg.Refresh("myfakeproduct")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(results).Should(HaveLen(1))
+			Ω(results[0].Err).ShouldNot(HaveOccurred())
+			Ω(results[0].Record.Name).Should(Equal("myfakeproduct"))
+			Ω(reg.ListProducts()).Should(HaveKey("myfakeproduct"))
+
+			e := received()
+			Ω(e[len(e)-1].Type).Should(Equal(Refreshed))
+		})
+
+		It("removes a plugin whose new binary fails to load", func() {
+			os.Remove(pluginpath)
+			copyFile("./fixtures/cloudconfig/testplugin-"+runtime.GOOS, pluginpath)
+
+			results, err := reg.Refresh("myfakeproduct")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(IsPluginError(results[0].Err, ErrDispense)).Should(BeTrue())
+			Ω(reg.ListProducts()).ShouldNot(HaveKey("myfakeproduct"))
+
+			e := received()
+			Ω(e[len(e)-1].Type).Should(Equal(Unregistered))
+		})
+
+		It("stops pooled processes for the plugin", func() {
+			pool := NewPool(reg, PoolOptions{})
+			defer pool.Shutdown()
+			first, err := pool.Product("myfakeproduct", Latest)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, err = reg.Refresh("myfakeproduct")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(pool.procs).Should(BeEmpty())
+
+			second, err := pool.Product("myfakeproduct", Latest)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(second).ShouldNot(BeIdenticalTo(first))
+		})
+
+		It("returns an error for a plugin that is not registered", func() {
+			_, err := reg.Refresh("p-rabbitmq")
+			Ω(err).Should(BeAssignableToTypeOf(&NotFoundError{}))
+		})
+	})
+})
@@ -0,0 +1,378 @@
+package registry
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// Install unpacks the plugin in the .tgz, .tar.gz or .zip archive into its
+// own directory in home, named after the plugin, and registers it.
+// An archive may hold binaries for several platforms named with a
+// "-GOOS-GOARCH" or "-GOOS" suffix, such as myplugin-linux or
+// myplugin-darwin-amd64, and the one matching the running platform is
+// used.  An archive holding a single binary is used on any platform.
+//
+// Installed plugins can be registered again later by calling Discover
+// on each directory in home.
+func (r *Registry) Install(home, archive string) (Record, error) {
+	staging, err := stage(home, archive)
+	if err != nil {
+		return Record{}, err
+	}
+	defer os.RemoveAll(staging)
+
+	binary, err := findBinary(staging)
+	if err != nil {
+		return Record{}, err
+	}
+	record, typ, err := r.probe(binary)
+	if err != nil {
+		return Record{}, err
+	}
+
+	if record.Name == "" || record.Name == "." || record.Name == ".." || strings.ContainsAny(record.Name, `/\`) {
+		return Record{}, fmt.Errorf("registry: cannot install a plugin named %q", record.Name)
+	}
+	rel, err := filepath.Rel(staging, binary)
+	if err != nil {
+		return Record{}, err
+	}
+	dir := filepath.Join(home, record.Name)
+	if _, err = os.Stat(dir); err == nil {
+		return Record{}, fmt.Errorf("registry: %s is already installed in %s", record.Name, home)
+	}
+	if err = os.Rename(staging, dir); err != nil {
+		return Record{}, err
+	}
+	record.Path = filepath.Join(dir, rel)
+	r.add(record, typ)
+	return record.copy(), nil
+}
+
+// Upgrade replaces the installed plugin called name with the one in
+// archive.  If the new plugin fails to start or is not called name, the
+// previous installation is restored and remains registered.  Versions of
+// the plugin registered from elsewhere are kept.
+func (r *Registry) Upgrade(home, name, archive string) (Record, error) {
+	dir := filepath.Join(home, name)
+	if _, err := os.Stat(dir); err != nil {
+		return Record{}, &NotFoundError{Name: name}
+	}
+	staging, err := stage(home, archive)
+	if err != nil {
+		return Record{}, err
+	}
+	defer os.RemoveAll(staging)
+	if _, err = findBinary(staging); err != nil {
+		return Record{}, err
+	}
+
+	// move the current installation aside so the new one runs from the
+	// same directory, and move it back if anything goes wrong
+	backup, err := ioutil.TempDir(home, ".backup-")
+	if err != nil {
+		return Record{}, err
+	}
+	defer os.RemoveAll(backup)
+	old := filepath.Join(backup, name)
+	if err = os.Rename(dir, old); err != nil {
+		return Record{}, err
+	}
+	if err = os.Rename(staging, dir); err != nil {
+		os.Rename(old, dir)
+		return Record{}, err
+	}
+
+	record, typ, err := r.probeDir(dir)
+	if err == nil && record.Name != name {
+		err = fmt.Errorf("registry: %s contains %s, not %s", archive, record.Name, name)
+	}
+	if err != nil {
+		os.RemoveAll(dir)
+		if rerr := os.Rename(old, dir); rerr != nil {
+			return Record{}, fmt.Errorf("%v; restoring %s also failed: %v", err, dir, rerr)
+		}
+		return Record{}, err
+	}
+
+	r.unregisterIn(name, dir)
+	r.add(record, typ)
+	return record.copy(), nil
+}
+
+// Uninstall removes the installed plugin called name from home and from
+// the registry.  Versions of the plugin registered from elsewhere are kept.
+func (r *Registry) Uninstall(home, name string) error {
+	dir := filepath.Join(home, name)
+	if _, err := os.Stat(dir); err != nil {
+		return &NotFoundError{Name: name}
+	}
+	r.unregisterIn(name, dir)
+	return os.RemoveAll(dir)
+}
+
+// unregisterIn removes the plugins called name that run from a binary in
+// dir, leaving other versions of the plugin registered.
+func (r *Registry) unregisterIn(name, dir string) {
+	r.mu.Lock()
+	var removed []Record
+	for version, record := range r.products[name] {
+		if inDir(record.Path, dir) {
+			removed = append(removed, record)
+			delete(r.products[name], version)
+		}
+	}
+	if len(r.products[name]) == 0 {
+		delete(r.products, name)
+	}
+	if record, ok := r.cloudconfigs[name]; ok && inDir(record.Path, dir) {
+		removed = append(removed, record)
+		delete(r.cloudconfigs, name)
+	}
+	r.mu.Unlock()
+
+	sort.Sort(byNameAndVersion(removed))
+	for _, record := range removed {
+		r.notify(Event{Type: Unregistered, Record: record.copy()})
+	}
+}
+
+// inDir reports whether path is inside dir.
+func inDir(path, dir string) bool {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	dir, err = filepath.Abs(dir)
+	if err != nil {
+		return false
+	}
+	return strings.HasPrefix(path, dir+string(filepath.Separator))
+}
+
+// Install installs a plugin into home and registers it with the default registry.
+func Install(home, archive string) (Record, error) {
+	return defaultRegistry.Install(home, archive)
+}
+
+// Upgrade upgrades an installed plugin in the default registry.
+func Upgrade(home, name, archive string) (Record, error) {
+	return defaultRegistry.Upgrade(home, name, archive)
+}
+
+// Uninstall removes an installed plugin from home and the default registry.
+func Uninstall(home, name string) error {
+	return defaultRegistry.Uninstall(home, name)
+}
+
+// add registers a record found by probe.
+func (r *Registry) add(record Record, typ string) {
+	if typ == cloudConfigType {
+		r.addCloudConfig(record)
+	} else {
+		r.addProduct(record)
+	}
+	r.notify(Event{Type: Registered, Record: record.copy()})
+}
+
+// stage unpacks archive into a new directory in home.
+func stage(home, archive string) (string, error) {
+	if err := os.MkdirAll(home, 0755); err != nil {
+		return "", err
+	}
+	staging, err := ioutil.TempDir(home, ".install-")
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case strings.HasSuffix(archive, ".tgz"), strings.HasSuffix(archive, ".tar.gz"):
+		err = untar(archive, staging)
+	case strings.HasSuffix(archive, ".zip"):
+		err = unzip(archive, staging)
+	default:
+		err = errors.New("unsupported archive format")
+	}
+	if err != nil {
+		os.RemoveAll(staging)
+		return "", fmt.Errorf("registry: unpacking %s: %v", archive, err)
+	}
+	return staging, nil
+}
+
+// probe detects the type of the plugin at pluginpath and reads its record
+// without adding it to the registry.  The plugin is started with r's
+// verifier, logging, process and reattach settings.
+func (r *Registry) probe(pluginpath string) (Record, string, error) {
+	p := New()
+	r.mu.RLock()
+	p.verifier = r.verifier
+	p.logging = r.logging
+	p.process = r.process
+	p.reattach = make(map[string]ReattachConfig, len(r.reattach))
+	for path, rc := range r.reattach {
+		p.reattach[path] = rc
+	}
+	r.mu.RUnlock()
+
+	var report Report
+	p.discover(&report, pluginpath)
+	switch {
+	case len(report.Products) > 0:
+		return report.Products[0], productType, nil
+	case len(report.CloudConfigs) > 0:
+		return report.CloudConfigs[0], cloudConfigType, nil
+	}
+	return Record{}, "", report.Skipped[0].Reason
+}
+
+// probeDir probes the binary installed in dir.
+func (r *Registry) probeDir(dir string) (Record, string, error) {
+	binary, err := findBinary(dir)
+	if err != nil {
+		return Record{}, "", err
+	}
+	return r.probe(binary)
+}
+
+// findBinary returns the plugin binary in dir for the running platform.
+func findBinary(dir string) (string, error) {
+	var candidates []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() && !isCompanion(info.Name()) {
+			candidates = append(candidates, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	suffixes := []string{"-" + runtime.GOOS + "-" + runtime.GOARCH, "-" + runtime.GOOS}
+	for _, suffix := range suffixes {
+		for _, path := range candidates {
+			name := filepath.Base(path)
+			if runtime.GOOS == "windows" {
+				name = strings.TrimSuffix(name, ".exe")
+			}
+			if strings.HasSuffix(name, suffix) {
+				return path, os.Chmod(path, 0755)
+			}
+		}
+	}
+	if len(candidates) == 1 {
+		return candidates[0], os.Chmod(candidates[0], 0755)
+	}
+	return "", fmt.Errorf("registry: no plugin binary for %s/%s in archive", runtime.GOOS, runtime.GOARCH)
+}
+
+// target returns where the archive entry name should be written in dir,
+// refusing names that would escape it.
+func target(dir, name string) (string, error) {
+	path := filepath.Join(dir, filepath.FromSlash(name))
+	if path != dir && !strings.HasPrefix(path, dir+string(filepath.Separator)) {
+		return "", fmt.Errorf("illegal path %q", name)
+	}
+	return path, nil
+}
+
+func untar(archive, dir string) error {
+	f, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		path, err := target(dir, hdr.Name)
+		if err != nil {
+			return err
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(path, 0755)
+		case tar.TypeReg, tar.TypeRegA:
+			err = writeFile(path, tr, os.FileMode(hdr.Mode))
+		default:
+			err = fmt.Errorf("unsupported file type for %q", hdr.Name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func unzip(archive, dir string) error {
+	zr, err := zip.OpenReader(archive)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	for _, zf := range zr.File {
+		path, err := target(dir, zf.Name)
+		if err != nil {
+			return err
+		}
+		mode := zf.Mode()
+		if mode.IsDir() {
+			if err = os.MkdirAll(path, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+		if !mode.IsRegular() {
+			return fmt.Errorf("unsupported file type for %q", zf.Name)
+		}
+		rc, err := zf.Open()
+		if err != nil {
+			return err
+		}
+		err = writeFile(path, rc, mode)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeFile(path string, r io.Reader, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode.Perm()|0600)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,218 @@
+package registry_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	. "github.com/enaml-ops/pluginlib/registry"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// archiveFile is a file to put in a test archive.
+type archiveFile struct {
+	name     string
+	contents []byte
+}
+
+func readFixture(path string) []byte {
+	b, err := ioutil.ReadFile(path)
+	Ω(err).ShouldNot(HaveOccurred())
+	return b
+}
+
+func writeTgz(path string, files ...archiveFile) {
+	f, err := os.Create(path)
+	Ω(err).ShouldNot(HaveOccurred())
+	defer f.Close()
+	// fixtures are stored uncompressed to keep the tests fast
+	gz, err := gzip.NewWriterLevel(f, gzip.NoCompression)
+	Ω(err).ShouldNot(HaveOccurred())
+	tw := tar.NewWriter(gz)
+	for _, file := range files {
+		Ω(tw.WriteHeader(&tar.Header{Name: file.name, Mode: 0755, Size: int64(len(file.contents)), Typeflag: tar.TypeReg})).Should(Succeed())
+		_, err = tw.Write(file.contents)
+		Ω(err).ShouldNot(HaveOccurred())
+	}
+	Ω(tw.Close()).Should(Succeed())
+	Ω(gz.Close()).Should(Succeed())
+}
+
+func writeZip(path string, files ...archiveFile) {
+	f, err := os.Create(path)
+	Ω(err).ShouldNot(HaveOccurred())
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	for _, file := range files {
+		hdr := &zip.FileHeader{Name: file.name, Method: zip.Store}
+		hdr.SetMode(0755)
+		w, err := zw.CreateHeader(hdr)
+		Ω(err).ShouldNot(HaveOccurred())
+		_, err = w.Write(file.contents)
+		Ω(err).ShouldNot(HaveOccurred())
+	}
+	Ω(zw.Close()).Should(Succeed())
+}
+
+var _ = Describe("plugin installation", func() {
+	var (
+		tmp  string
+		home string
+		reg  *Registry
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmp, err = ioutil.TempDir("", "registry-install")
+		Ω(err).ShouldNot(HaveOccurred())
+		home = filepath.Join(tmp, "home")
+		reg = New()
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(tmp)
+	})
+
+	Context("when an archive is unsafe or unsupported", func() {
+		It("then it should refuse entries outside the plugin directory", func() {
+			archive := filepath.Join(tmp, "evil.tgz")
+			writeTgz(archive, archiveFile{name: "../escaped", contents: []byte("x")})
+			_, err := reg.Install(home, archive)
+			Ω(err).Should(MatchError(ContainSubstring("illegal path")))
+			_, err = os.Stat(filepath.Join(tmp, "escaped"))
+			Ω(os.IsNotExist(err)).Should(BeTrue())
+		})
+
+		It("then it should refuse unknown archive formats", func() {
+			archive := filepath.Join(tmp, "plugin.rar")
+			Ω(ioutil.WriteFile(archive, nil, 0644)).Should(Succeed())
+			_, err := reg.Install(home, archive)
+			Ω(err).Should(MatchError(ContainSubstring("unsupported archive format")))
+		})
+
+		It("then it should fail when there is no binary for this platform", func() {
+			archive := filepath.Join(tmp, "plugin.zip")
+			writeZip(archive,
+				archiveFile{name: "p-plan9", contents: []byte("x")},
+				archiveFile{name: "p-nacl", contents: []byte("x")},
+			)
+			_, err := reg.Install(home, archive)
+			Ω(err).Should(MatchError(ContainSubstring("no plugin binary for " + runtime.GOOS)))
+		})
+	})
+
+	Context("when the archive holds plugin binaries", func() {
+		var (
+			product     []byte
+			cloudconfig []byte
+		)
+
+		BeforeEach(func() {
+			if testing.Short() {
+				Skip("plugin registry tests skipped in short mode")
+			}
+			product = readFixture("./fixtures/product/testproductplugin-" + runtime.GOOS)
+			cloudconfig = readFixture("./fixtures/cloudconfig/testplugin-" + runtime.GOOS)
+		})
+
+		It("then it should install the binary for this platform from a tarball", func() {
+			archive := filepath.Join(tmp, "product.tgz")
+			writeTgz(archive,
+				archiveFile{name: "bin/myproduct-plan9", contents: []byte("not this one")},
+				archiveFile{name: "bin/myproduct-" + runtime.GOOS, contents: product},
+			)
+			record, err := reg.Install(home, archive)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(record.Name).Should(Equal("myfakeproduct"))
+			Ω(record.Path).Should(Equal(filepath.Join(home, "myfakeproduct", "bin", "myproduct-"+runtime.GOOS)))
+			Ω(reg.ListProducts()).Should(HaveKey("myfakeproduct"))
+
+			_, err = reg.Install(home, archive)
+			Ω(err).Should(MatchError(ContainSubstring("already installed")))
+
+			Ω(reg.Uninstall(home, "myfakeproduct")).Should(Succeed())
+			Ω(reg.ListProducts()).ShouldNot(HaveKey("myfakeproduct"))
+			_, err = os.Stat(filepath.Join(home, "myfakeproduct"))
+			Ω(os.IsNotExist(err)).Should(BeTrue())
+		})
+
+		It("then it should install a cloud config plugin from a zip file", func() {
+			archive := filepath.Join(tmp, "cc.zip")
+			writeZip(archive, archiveFile{name: "cc", contents: cloudconfig})
+			record, err := reg.Install(home, archive)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(reg.ListCloudConfigs()).Should(HaveKey(record.Name))
+		})
+
+		It("then it should upgrade a plugin in place", func() {
+			archive := filepath.Join(tmp, "product.tgz")
+			writeTgz(archive, archiveFile{name: "myproduct", contents: product})
+			_, err := reg.Install(home, archive)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			upgrade := filepath.Join(tmp, "product-2.zip")
+			writeZip(upgrade, archiveFile{name: "myproduct-" + runtime.GOOS, contents: product})
+			record, err := reg.Upgrade(home, "myfakeproduct", upgrade)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(record.Path).Should(Equal(filepath.Join(home, "myfakeproduct", "myproduct-"+runtime.GOOS)))
+			Ω(reg.ListProducts()["myfakeproduct"].Path).Should(Equal(record.Path))
+		})
+
+		It("then it should keep versions registered from elsewhere when upgrading or uninstalling", func() {
+			other := filepath.Join(tmp, "other", "myproduct")
+			Ω(os.MkdirAll(filepath.Dir(other), 0755)).Should(Succeed())
+			Ω(ioutil.WriteFile(other, product, 0755)).Should(Succeed())
+			manifest := "type: product\nname: myfakeproduct\nversion: 0.9.0\nprotocol_versions: [2]\n"
+			Ω(ioutil.WriteFile(other+".yml", []byte(manifest), 0644)).Should(Succeed())
+			_, err := reg.RegisterProduct(other)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			archive := filepath.Join(tmp, "product.tgz")
+			writeTgz(archive, archiveFile{name: "myproduct", contents: product})
+			_, err = reg.Install(home, archive)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			record, err := reg.Upgrade(home, "myfakeproduct", archive)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(reg.GetProduct("myfakeproduct", record.Version)).Should(Equal(record))
+			kept, err := reg.GetProduct("myfakeproduct", "0.9.0")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(kept.Path).Should(Equal(other))
+
+			Ω(reg.Uninstall(home, "myfakeproduct")).Should(Succeed())
+			_, err = reg.GetProduct("myfakeproduct", record.Version)
+			Ω(err).Should(HaveOccurred())
+			_, err = reg.GetProduct("myfakeproduct", "0.9.0")
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("then it should start the plugin with the registry's process options", func() {
+			reg.UseProcessOptions(ProcessOptions{ExtraEnv: []string{"NOT A VARIABLE"}})
+			archive := filepath.Join(tmp, "product.tgz")
+			writeTgz(archive, archiveFile{name: "myproduct", contents: product})
+			_, err := reg.Install(home, archive)
+			Ω(err).Should(MatchError(ContainSubstring("invalid environment variable")))
+		})
+
+		It("then it should roll back an upgrade whose plugin fails to start", func() {
+			archive := filepath.Join(tmp, "product.tgz")
+			writeTgz(archive, archiveFile{name: "myproduct", contents: product})
+			installed, err := reg.Install(home, archive)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			broken := filepath.Join(tmp, "broken.tgz")
+			writeTgz(broken, archiveFile{name: "myproduct", contents: []byte("#!/bin/sh\nexit 1\n")})
+			_, err = reg.Upgrade(home, "myfakeproduct", broken)
+			Ω(err).Should(HaveOccurred())
+
+			Ω(readFixture(installed.Path)).Should(Equal(product))
+			Ω(reg.ListProducts()["myfakeproduct"].Path).Should(Equal(installed.Path))
+		})
+	})
+})
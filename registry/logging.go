@@ -0,0 +1,187 @@
+package registry
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-plugin"
+	"github.com/xchapter7x/lo"
+)
+
+// Logger receives the output of plugin processes.
+// *log.Logger satisfies this interface.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// LogOptions controls where the output of plugin processes is sent.
+type LogOptions struct {
+	// Logger receives each line a plugin writes to stdout or stderr,
+	// tagged with the plugin's name and PID.
+	// It defaults to debug-level logging through lo.G.
+	Logger Logger
+
+	// Dir, when not empty, is a directory in which each plugin's output
+	// is also appended to a file named after the plugin, such as
+	// myproduct.log.  Characters other than lower case letters, digits,
+	// dots, dashes and underscores are replaced in the file name.
+	Dir string
+}
+
+// UseLogging configures where the output of plugin processes started
+// by the registry is sent.
+func (r *Registry) UseLogging(opts LogOptions) {
+	r.mu.Lock()
+	r.logging = opts
+	r.mu.Unlock()
+}
+
+// UseLogging configures plugin output for the default registry.
+func UseLogging(opts LogOptions) {
+	defaultRegistry.UseLogging(opts)
+}
+
+type debugLogger struct{}
+
+func (debugLogger) Printf(format string, v ...interface{}) {
+	lo.G.Debugf(format, v...)
+}
+
+// pluginName returns the registered name of the plugin at pluginpath,
+// or the binary's file name if it has not been registered yet.
+func (r *Registry) pluginName(pluginpath string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, versions := range r.products {
+		for _, record := range versions {
+			if record.Path == pluginpath {
+				return record.Name
+			}
+		}
+	}
+	for _, record := range r.cloudconfigs {
+		if record.Path == pluginpath {
+			return record.Name
+		}
+	}
+	return filepath.Base(pluginpath)
+}
+
+// newPluginWriter returns a writer for the output of the plugin run by cmd,
+// or of the already running plugin with the given pid when cmd is nil.
+func (r *Registry) newPluginWriter(pluginpath string, cmd *exec.Cmd, pid int) *pluginWriter {
+	r.mu.RLock()
+	opts := r.logging
+	r.mu.RUnlock()
+	if opts.Logger == nil {
+		opts.Logger = debugLogger{}
+	}
+	return &pluginWriter{
+		name: r.pluginName(pluginpath),
+		cmd:  cmd,
+		pid:  pid,
+		opts: opts,
+	}
+}
+
+// pluginWriter splits plugin output into lines and sends each line to
+// the host's logger, tagged with the plugin's name and PID.
+type pluginWriter struct {
+	name string
+	cmd  *exec.Cmd
+	pid  int
+	opts LogOptions
+
+	mu   sync.Mutex
+	buf  bytes.Buffer
+	file *os.File
+}
+
+// exitPoll is how often a plugin is checked for having exited.
+var exitPoll = 100 * time.Millisecond
+
+// closeOnExit closes writers once the plugin process of client has exited.
+func closeOnExit(client *plugin.Client, writers ...*pluginWriter) {
+	go func() {
+		for !client.Exited() {
+			time.Sleep(exitPoll)
+		}
+		for _, w := range writers {
+			w.Close()
+		}
+	}()
+}
+
+func (w *pluginWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buf.Write(p)
+	for {
+		i := bytes.IndexByte(w.buf.Bytes(), '\n')
+		if i == -1 {
+			break
+		}
+		line := string(w.buf.Next(i + 1))
+		w.log(line[:len(line)-1])
+	}
+	return len(p), nil
+}
+
+// Close logs any output left without a trailing newline and closes the
+// plugin's log file.
+func (w *pluginWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.buf.Len() > 0 {
+		w.log(w.buf.String())
+		w.buf.Reset()
+	}
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+var unsafeLogRE = regexp.MustCompile(`[^a-z0-9._-]`)
+
+// logFileName returns the name of the log file for the plugin name, which
+// comes from the plugin itself and so cannot be trusted to stay inside the
+// log directory.
+func logFileName(name string) string {
+	name = unsafeLogRE.ReplaceAllString(strings.ToLower(filepath.Base(name)), "_")
+	name = strings.TrimLeft(name, ".")
+	if name == "" {
+		name = "plugin"
+	}
+	return name + ".log"
+}
+
+func (w *pluginWriter) log(line string) {
+	pid := w.pid
+	if w.cmd != nil && w.cmd.Process != nil {
+		pid = w.cmd.Process.Pid
+	}
+	w.opts.Logger.Printf("[plugin %s pid=%d] %s", w.name, pid, line)
+
+	if w.opts.Dir == "" {
+		return
+	}
+	if w.file == nil {
+		f, err := os.OpenFile(filepath.Join(w.opts.Dir, logFileName(w.name)), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			lo.G.Debug("registry: failed to open plugin log:", err)
+			return
+		}
+		w.file = f
+	}
+	fmt.Fprintf(w.file, "%s pid=%d %s\n", time.Now().Format(time.RFC3339), pid, line)
+}
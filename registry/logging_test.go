@@ -0,0 +1,115 @@
+package registry
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type recordingLogger struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (l *recordingLogger) Printf(format string, v ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lines = append(l.lines, fmt.Sprintf(format, v...))
+}
+
+func (l *recordingLogger) Lines() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.lines...)
+}
+
+var _ = Describe("plugin output", func() {
+	var (
+		reg        *Registry
+		logger     *recordingLogger
+		dir        string
+		pluginpath = "./fixtures/logging/testloggingplugin-" + runtime.GOOS
+	)
+
+	BeforeEach(func() {
+		if testing.Short() {
+			Skip("plugin registry tests skipped in short mode")
+		}
+		var err error
+		dir, err = ioutil.TempDir("", "registry-logs")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		logger = new(recordingLogger)
+		reg = New()
+		reg.UseLogging(LogOptions{Logger: logger, Dir: dir})
+		_, err = reg.RegisterProduct(pluginpath)
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("then it should send plugin output to the host logger tagged with the plugin's name and PID", func() {
+		client, p, err := reg.GetProductReference(pluginpath)
+		Ω(err).ShouldNot(HaveOccurred())
+		defer client.Kill()
+		p.GetMeta()
+
+		Eventually(logger.Lines).Should(ContainElement(MatchRegexp(`^\[plugin loggingproduct pid=[1-9][0-9]*\] .*GetMeta called$`)))
+	})
+
+	It("then it should write each plugin's output to its own log file", func() {
+		Eventually(func() string {
+			b, _ := ioutil.ReadFile(filepath.Join(dir, "testloggingplugin-"+runtime.GOOS+".log"))
+			return string(b)
+		}).Should(ContainSubstring("GetMeta called"))
+	})
+
+	It("then it should log output without a trailing newline once the plugin exits", func() {
+		client, p, err := reg.GetProductReference(pluginpath)
+		Ω(err).ShouldNot(HaveOccurred())
+		p.GetMeta()
+		client.Kill()
+
+		Eventually(logger.Lines).Should(ContainElement(MatchRegexp(`^\[plugin loggingproduct pid=[1-9][0-9]*\] partial line$`)))
+		Eventually(func() string {
+			b, _ := ioutil.ReadFile(filepath.Join(dir, "loggingproduct.log"))
+			return string(b)
+		}).Should(ContainSubstring("partial line"))
+	})
+
+	It("then it should keep the log file open until the plugin exits", func() {
+		w := &pluginWriter{name: "myproduct", pid: 1, opts: LogOptions{Logger: logger, Dir: dir}}
+		fmt.Fprintln(w, "first")
+		f := w.file
+		Ω(f).ShouldNot(BeNil())
+		fmt.Fprint(w, "second")
+		Ω(w.file).Should(BeIdenticalTo(f))
+
+		Ω(w.Close()).Should(Succeed())
+		Ω(w.file).Should(BeNil())
+		b, err := ioutil.ReadFile(filepath.Join(dir, "myproduct.log"))
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(string(b)).Should(MatchRegexp(`pid=1 first\n.* pid=1 second\n$`))
+	})
+
+	It("then it should keep log files inside the log directory", func() {
+		w := &pluginWriter{name: "../../evil", pid: 1, opts: LogOptions{Logger: logger, Dir: dir}}
+		fmt.Fprintln(w, "escaped")
+		w.Close()
+		_, err := os.Stat(filepath.Join(dir, "evil.log"))
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(logFileName("My Product/..")).Should(Equal("plugin.log"))
+		Ω(logFileName("My Product")).Should(Equal("my_product.log"))
+		Ω(logFileName("p-mysql_1.9")).Should(Equal("p-mysql_1.9.log"))
+	})
+})
@@ -0,0 +1,191 @@
+package registry
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/enaml-ops/pluginlib/pcli"
+	"gopkg.in/yaml.v2"
+)
+
+// ManifestExts are appended to a plugin's path to find its manifest, in
+// order of preference.  Files ending in .json are parsed as JSON and all
+// others as YAML.
+var ManifestExts = []string{".yml", ".yaml", ".json"}
+
+// readManifest reads the manifest of the plugin at pluginpath.
+// ok is false when the plugin has no manifest.
+func readManifest(pluginpath string) (Manifest, bool, error) {
+	for _, ext := range ManifestExts {
+		var m Manifest
+		b, err := ioutil.ReadFile(pluginpath + ext)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return Manifest{}, true, &PluginError{Path: pluginpath, Kind: ErrManifest, Err: err}
+		}
+		if ext == ".json" {
+			err = json.Unmarshal(b, &m)
+		} else {
+			err = yaml.Unmarshal(b, &m)
+			m.Properties = stringKeys(m.Properties).(map[string]interface{})
+		}
+		if err == nil {
+			err = m.validate()
+		}
+		if err != nil {
+			return Manifest{}, true, &PluginError{Path: pluginpath, Kind: ErrManifest, Err: fmt.Errorf("%s: %v", pluginpath+ext, err)}
+		}
+		return m, true, nil
+	}
+	return Manifest{}, false, nil
+}
+
+// validate checks that the manifest is complete.
+func (m Manifest) validate() error {
+	switch {
+	case m.Name == "":
+		return errors.New("name is required")
+	case m.Type != productType && m.Type != cloudConfigType:
+		return fmt.Errorf("type must be %q or %q, not %q", productType, cloudConfigType, m.Type)
+	case len(m.ProtocolVersions) == 0:
+		return errors.New("protocol_versions is required")
+	}
+	if m.Checksum != "" {
+		sum := m.sha256()
+		if len(sum) != 64 || strings.Trim(sum, "0123456789abcdef") != "" {
+			return fmt.Errorf("checksum %q is not a SHA-256 checksum", m.Checksum)
+		}
+	}
+	return nil
+}
+
+func (m Manifest) sha256() string {
+	return strings.TrimPrefix(strings.ToLower(m.Checksum), "sha256:")
+}
+
+// manifestRecord checks that the plugin at pluginpath matches its
+// manifest and returns the record and flags the manifest describes.
+func (r *Registry) manifestRecord(pluginpath string, m Manifest, typ string) (Record, []pcli.Flag, error) {
+	if _, err := os.Stat(pluginpath); err != nil {
+		return Record{}, nil, &PluginError{Path: pluginpath, Kind: ErrMissingBinary, Err: err}
+	}
+	if m.Type != typ {
+		return Record{}, nil, &PluginError{Path: pluginpath, Kind: ErrDispense, Err: fmt.Errorf("manifest declares a %s plugin", m.Type)}
+	}
+
+	protocols := productProtocols
+	if typ == cloudConfigType {
+		protocols = cloudConfigProtocols
+	}
+	if err := m.checkProtocols(pluginpath, protocols); err != nil {
+		return Record{}, nil, err
+	}
+	r.rememberProtocol(pluginpath, m.protocol(protocols))
+
+	if m.Checksum != "" {
+		_, sum, err := checksum(pluginpath)
+		if err != nil {
+			return Record{}, nil, &PluginError{Path: pluginpath, Kind: ErrVerification, Err: err}
+		}
+		if sum != m.sha256() {
+			return Record{}, nil, &PluginError{Path: pluginpath, Kind: ErrVerification, Err: fmt.Errorf("checksum %s does not match the manifest", sum)}
+		}
+	}
+	if err := r.verify(pluginpath); err != nil {
+		return Record{}, nil, err
+	}
+
+	record := Record{
+		Name:       m.Name,
+		Version:    m.Version,
+		Path:       pluginpath,
+		Properties: m.Properties,
+	}.copy()
+	if typ == productType {
+		record.Description = m.Description
+		record.Homepage = m.Homepage
+		record.IaaS = m.IaaS
+		record.MinProtocol = m.MinProtocol
+		record.Dependencies = m.Dependencies
+		if err := validateProduct(record); err != nil {
+			return Record{}, nil, &PluginError{Path: pluginpath, Kind: ErrManifest, Err: err}
+		}
+		if err := checkMinProtocol(pluginpath, record.MinProtocol); err != nil {
+			return Record{}, nil, err
+		}
+	}
+	// cloud config records have no Description field
+	if typ == cloudConfigType && m.Description != "" {
+		if record.Properties == nil {
+			record.Properties = make(map[string]interface{})
+		}
+		if _, ok := record.Properties["description"]; !ok {
+			record.Properties["description"] = m.Description
+		}
+	}
+	return record, m.Flags, nil
+}
+
+// protocol returns the newest of protocols that the plugin speaks, or
+// zero if there is none.
+func (m Manifest) protocol(protocols []protocol) uint {
+	for _, p := range newest(protocols) {
+		for _, v := range m.ProtocolVersions {
+			if v == p.handshake.ProtocolVersion {
+				return v
+			}
+		}
+	}
+	return 0
+}
+
+// checkProtocols returns an error if the plugin speaks none of protocols.
+func (m Manifest) checkProtocols(pluginpath string, protocols []protocol) error {
+	min, max := m.ProtocolVersions[0], m.ProtocolVersions[0]
+	for _, v := range m.ProtocolVersions {
+		if _, ok := find(protocols, v); ok {
+			return nil
+		}
+		if v < min {
+			min = v
+		}
+		if v > max {
+			max = v
+		}
+	}
+	oldest := newest(protocols)[len(protocols)-1].handshake.ProtocolVersion
+	if max < oldest {
+		return mismatch(pluginpath, max, protocols)
+	}
+	return mismatch(pluginpath, min, protocols)
+}
+
+// stringKeys converts the maps produced by the YAML decoder, which have
+// interface{} keys, into maps with string keys that can be stored as JSON.
+func stringKeys(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		res := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			res[fmt.Sprint(k)] = stringKeys(val)
+		}
+		return res
+	case map[string]interface{}:
+		for k, val := range v {
+			v[k] = stringKeys(val)
+		}
+		return v
+	case []interface{}:
+		for i, val := range v {
+			v[i] = stringKeys(val)
+		}
+		return v
+	}
+	return v
+}
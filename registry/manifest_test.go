@@ -0,0 +1,168 @@
+package registry_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/enaml-ops/pluginlib/pcli"
+	. "github.com/enaml-ops/pluginlib/registry"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("given a plugin with a manifest", func() {
+	var (
+		dir        string
+		pluginpath string
+		reg        *Registry
+	)
+
+	// the binary fails if it is ever run, so registration can only
+	// succeed by reading the manifest
+	binary := []byte("#!/bin/sh\nexit 1\n")
+
+	writeManifest := func(ext, contents string) {
+		Ω(ioutil.WriteFile(pluginpath+ext, []byte(contents), 0644)).Should(Succeed())
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "registry-manifest")
+		Ω(err).ShouldNot(HaveOccurred())
+		pluginpath = filepath.Join(dir, "myplugin")
+		Ω(ioutil.WriteFile(pluginpath, binary, 0755)).Should(Succeed())
+		reg = New()
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	Context("when the manifest is YAML", func() {
+		BeforeEach(func() {
+			sum := sha256.Sum256(binary)
+			writeManifest(".yml", `name: manifestproduct
+version: 1.2.0
+type: product
+protocol_versions: [2, 3]
+checksum: sha256:`+hex.EncodeToString(sum[:])+`
+description: a product described by its manifest
+properties:
+  stemcell:
+    os: ubuntu-trusty
+flags:
+- name: az
+  usage: availability zones
+`)
+		})
+
+		It("then it should register the product without running it", func() {
+			flags, err := reg.RegisterProduct(pluginpath)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(flags).Should(Equal([]pcli.Flag{{Name: "az", Usage: "availability zones"}}))
+
+			record, err := reg.GetProduct("manifestproduct", "1.2.0")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(record.Path).Should(Equal(pluginpath))
+			Ω(record.Description).Should(Equal("a product described by its manifest"))
+			Ω(record.Properties).ShouldNot(HaveKey("description"))
+			Ω(record.Properties).Should(HaveKeyWithValue("stemcell", map[string]interface{}{"os": "ubuntu-trusty"}))
+		})
+
+		It("then it should refuse to register it as a cloud config", func() {
+			_, err := reg.RegisterCloudConfig(pluginpath)
+			Ω(IsPluginError(err, ErrDispense)).Should(BeTrue())
+		})
+	})
+
+	Context("when the manifest is JSON", func() {
+		BeforeEach(func() {
+			writeManifest(".json", `{"name": "manifestcc", "type": "cloudconfig", "protocol_versions": [2], "description": "a cloud config"}`)
+		})
+
+		It("then it should be discovered as a cloud config plugin", func() {
+			report := reg.Discover(dir)
+			Ω(report.Skipped).Should(BeEmpty())
+			Ω(report.Products).Should(BeEmpty())
+			Ω(report.CloudConfigs).Should(HaveLen(1))
+			Ω(report.CloudConfigs[0].Name).Should(Equal("manifestcc"))
+			Ω(report.CloudConfigs[0].Properties).Should(HaveKeyWithValue("description", "a cloud config"))
+		})
+	})
+
+	Context("when the manifest checksum does not match the binary", func() {
+		It("then it should return a verification error", func() {
+			writeManifest(".yml", "name: p\ntype: product\nprotocol_versions: [2]\nchecksum: "+hex.EncodeToString(make([]byte, 32))+"\n")
+			_, err := reg.RegisterProduct(pluginpath)
+			Ω(IsPluginError(err, ErrVerification)).Should(BeTrue())
+		})
+	})
+
+	Context("when the manifest is invalid", func() {
+		It("then it should return a manifest error", func() {
+			for _, contents := range []string{
+				"type: product\nprotocol_versions: [2]\n",
+				"name: p\ntype: plugin\nprotocol_versions: [2]\n",
+				"name: p\ntype: product\n",
+				"name: p\ntype: product\nprotocol_versions: [2]\nchecksum: abc\n",
+				"name: [",
+			} {
+				writeManifest(".yml", contents)
+				_, err := reg.RegisterProduct(pluginpath)
+				Ω(IsPluginError(err, ErrManifest)).Should(BeTrue(), contents)
+			}
+		})
+	})
+
+	Context("when the manifest describes the product", func() {
+		It("then the record should hold the description", func() {
+			writeManifest(".yml", `name: p
+type: product
+protocol_versions: [2]
+description: a product
+homepage: https://example.com/p
+iaas: [aws, gcp]
+min_protocol: 2
+dependencies:
+- name: cf
+  version: ">=1.0.0"
+`)
+			_, err := reg.RegisterProduct(pluginpath)
+			Ω(err).ShouldNot(HaveOccurred())
+			record, err := reg.GetProduct("p", Latest)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(record.Description).Should(Equal("a product"))
+			Ω(record.Homepage).Should(Equal("https://example.com/p"))
+			Ω(record.IaaS).Should(Equal([]string{"aws", "gcp"}))
+			Ω(record.MinProtocol).Should(BeEquivalentTo(2))
+			Ω(record.Dependencies).Should(Equal([]Dependency{{Name: "cf", Version: ">=1.0.0"}}))
+		})
+
+		It("then it should reject a malformed description", func() {
+			writeManifest(".yml", "name: p\ntype: product\nprotocol_versions: [2]\niaas: [AWS]\n")
+			_, err := reg.RegisterProduct(pluginpath)
+			Ω(IsPluginError(err, ErrManifest)).Should(BeTrue())
+		})
+
+		It("then it should reject a product needing a newer host", func() {
+			writeManifest(".yml", "name: p\ntype: product\nprotocol_versions: [2]\nmin_protocol: 9\n")
+			_, err := reg.RegisterProduct(pluginpath)
+			Ω(IsPluginError(err, ErrTooNew)).Should(BeTrue())
+		})
+	})
+
+	Context("when the manifest lists protocol versions the host does not speak", func() {
+		It("then it should report whether the plugin is too old or too new", func() {
+			writeManifest(".yml", "name: p\ntype: product\nprotocol_versions: [1]\n")
+			_, err := reg.RegisterProduct(pluginpath)
+			Ω(IsPluginError(err, ErrTooOld)).Should(BeTrue())
+
+			writeManifest(".yml", "name: p\ntype: product\nprotocol_versions: [8, 9]\n")
+			_, err = reg.RegisterProduct(pluginpath)
+			Ω(IsPluginError(err, ErrTooNew)).Should(BeTrue())
+		})
+	})
+})
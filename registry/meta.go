@@ -0,0 +1,70 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+
+	"github.com/enaml-ops/pluginlib/productv1"
+)
+
+var iaasRE = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// validateProduct checks the shape of the metadata a product reported.
+func validateProduct(r Record) error {
+	if r.Homepage != "" {
+		u, err := url.Parse(r.Homepage)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("homepage %q is not an http or https URL", r.Homepage)
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, iaas := range r.IaaS {
+		if !iaasRE.MatchString(iaas) {
+			return fmt.Errorf("IaaS %q must be lower case letters, digits and dashes", iaas)
+		}
+		if seen[iaas] {
+			return fmt.Errorf("IaaS %q is listed twice", iaas)
+		}
+		seen[iaas] = true
+	}
+
+	seen = make(map[string]bool)
+	for _, d := range r.Dependencies {
+		switch {
+		case d.Name == "":
+			return errors.New("dependency with no name")
+		case d.Name == r.Name:
+			return fmt.Errorf("%s depends on itself", r.Name)
+		case seen[d.Name]:
+			return fmt.Errorf("dependency %s is listed twice", d.Name)
+		}
+		seen[d.Name] = true
+		if d.Version != "" {
+			if _, err := parseRange(d.Version); err != nil {
+				return fmt.Errorf("dependency %s: %v", d.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// checkMinProtocol returns an error if the product needs a newer protocol
+// version than the host supports.
+func checkMinProtocol(pluginpath string, min uint) error {
+	max := newest(productProtocols)[0].handshake.ProtocolVersion
+	if min > max {
+		return &PluginError{Path: pluginpath, Kind: ErrTooNew, Err: fmt.Errorf("plugin needs protocol version %d, host supports %s", min, protocolVersions(productProtocols))}
+	}
+	return nil
+}
+
+func dependencies(deps []product.Dependency) []Dependency {
+	var res []Dependency
+	for _, d := range deps {
+		res = append(res, Dependency{Name: d.Name, Version: d.Version})
+	}
+	return res
+}
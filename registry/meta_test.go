@@ -0,0 +1,41 @@
+package registry
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("product metadata validation", func() {
+	It("accepts well formed metadata", func() {
+		Ω(validateProduct(Record{
+			Name:         "p-spring-cloud",
+			Homepage:     "https://docs.pivotal.io/spring-cloud-services",
+			IaaS:         []string{"aws", "vsphere", "bosh-lite"},
+			Dependencies: []Dependency{{Name: "cf", Version: "^1.8.0"}, {Name: "p-mysql"}},
+		})).Should(Succeed())
+		Ω(validateProduct(Record{Name: "p"})).Should(Succeed())
+	})
+
+	It("rejects malformed metadata", func() {
+		for _, r := range []Record{
+			{Name: "p", Homepage: "docs.example.com"},
+			{Name: "p", Homepage: "ftp://example.com"},
+			{Name: "p", IaaS: []string{"AWS"}},
+			{Name: "p", IaaS: []string{""}},
+			{Name: "p", IaaS: []string{"aws", "aws"}},
+			{Name: "p", Dependencies: []Dependency{{Version: "1.x"}}},
+			{Name: "p", Dependencies: []Dependency{{Name: "p"}}},
+			{Name: "p", Dependencies: []Dependency{{Name: "cf"}, {Name: "cf"}}},
+			{Name: "p", Dependencies: []Dependency{{Name: "cf", Version: ">=banana"}}},
+		} {
+			Ω(validateProduct(r)).ShouldNot(Succeed(), "%+v", r)
+		}
+	})
+
+	It("rejects products needing a newer protocol than the host's", func() {
+		Ω(checkMinProtocol("p", 0)).Should(Succeed())
+		Ω(checkMinProtocol("p", newest(productProtocols)[0].handshake.ProtocolVersion)).Should(Succeed())
+		err := checkMinProtocol("p", 99)
+		Ω(IsPluginError(err, ErrTooNew)).Should(BeTrue())
+	})
+})
@@ -0,0 +1,320 @@
+package registry
+
+import (
+	"errors"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/enaml-ops/pluginlib/cloudconfigv1"
+	"github.com/enaml-ops/pluginlib/productv1"
+	"github.com/hashicorp/go-plugin"
+	"github.com/xchapter7x/lo"
+)
+
+// ErrPoolClosed is returned when a plugin is requested from a Pool
+// that has been shut down.
+var ErrPoolClosed = errors.New("registry: plugin pool is shut down")
+
+// PoolOptions configures a Pool.
+type PoolOptions struct {
+	// HealthInterval is how often running plugins are checked.
+	// Plugins that have exited or stopped responding are restarted.
+	// Zero disables health checks; crashed plugins are then restarted
+	// the next time they are requested.
+	HealthInterval time.Duration
+
+	// StartTimeout is how long each plugin process has to start.
+	StartTimeout time.Duration
+
+	// HealthTimeout is how long a plugin has to answer a health check.
+	// It defaults to five seconds.
+	HealthTimeout time.Duration
+}
+
+// Pool keeps plugin processes from a Registry running between calls, so
+// that each call does not pay the cost of starting the plugin again.
+// Deployers returned by a Pool must not be used after the Pool restarts
+// the plugin or is shut down.
+// A Pool is safe for use by multiple goroutines.
+type Pool struct {
+	reg  *Registry
+	opts PoolOptions
+
+	mu          sync.Mutex
+	procs       map[string]*process // keyed by plugin path
+	starting    map[string]*pending // plugins being started, by path
+	closed      bool
+	done        chan struct{}
+	unsubscribe func()
+}
+
+// process is a running plugin.
+type process struct {
+	typ    string
+	client *plugin.Client
+	raw    interface{}
+}
+
+// pending is a plugin that is being started.  done is closed once proc
+// and err are set.
+type pending struct {
+	done chan struct{}
+	proc *process
+	err  error
+}
+
+// healthy reports whether the plugin is still running and responding.
+func (p *process) healthy(timeout time.Duration) bool {
+	if p.client.Exited() {
+		return false
+	}
+	var callErr error
+	err := callWithTimeout(timeout, func() {
+		switch d := p.raw.(type) {
+		case product.Deployer:
+			_, callErr = product.GetMetaE(d)
+		case cloudconfig.Deployer:
+			_, callErr = cloudconfig.GetMetaE(d)
+		}
+	})
+	return err == nil && callErr == nil
+}
+
+// NewPool creates a Pool that starts plugins registered in r.
+func NewPool(r *Registry, opts PoolOptions) *Pool {
+	if opts.HealthTimeout <= 0 {
+		opts.HealthTimeout = 5 * time.Second
+	}
+	p := &Pool{
+		reg:      r,
+		opts:     opts,
+		procs:    make(map[string]*process),
+		starting: make(map[string]*pending),
+		done:     make(chan struct{}),
+	}
+	p.unsubscribe = r.Subscribe(p.handleEvent)
+	if opts.HealthInterval > 0 {
+		go p.checkHealth()
+	}
+	return p
+}
+
+// handleEvent stops the process for a plugin that has been unregistered
+// or refreshed, so the next request starts the current binary.
+func (p *Pool) handleEvent(e Event) {
+	if e.Type == Registered {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if proc, ok := p.procs[e.Record.Path]; ok {
+		lo.G.Debugf("registry: plugin %s was %s, stopping it", e.Record.Path, e.Type)
+		p.reg.release(e.Record.Path, proc.client)
+		delete(p.procs, e.Record.Path)
+	}
+	// a plugin being started may be running the old binary; get starts
+	// it again when it finds it is no longer pending
+	delete(p.starting, e.Record.Path)
+}
+
+// Product returns a running instance of the named product plugin.
+// An empty version or "latest" selects the newest registered version.
+func (p *Pool) Product(name, version string) (product.Deployer, error) {
+	record, err := p.reg.GetProduct(name, version)
+	if err != nil {
+		return nil, err
+	}
+	proc, err := p.get(record.Path, productType)
+	if err != nil {
+		return nil, err
+	}
+	return proc.raw.(product.Deployer), nil
+}
+
+// CloudConfig returns a running instance of the named cloud config plugin.
+func (p *Pool) CloudConfig(name string) (cloudconfig.Deployer, error) {
+	record, err := p.reg.GetCloudConfig(name)
+	if err != nil {
+		return nil, err
+	}
+	proc, err := p.get(record.Path, cloudConfigType)
+	if err != nil {
+		return nil, err
+	}
+	return proc.raw.(cloudconfig.Deployer), nil
+}
+
+// get returns the running plugin at pluginpath, starting it if it is
+// not running or has crashed.  Plugins are started without holding the
+// pool's lock, and callers asking for a plugin that is being started wait
+// for that start rather than starting it again.
+func (p *Pool) get(pluginpath, typ string) (*process, error) {
+	for {
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			return nil, ErrPoolClosed
+		}
+		if proc, ok := p.procs[pluginpath]; ok {
+			if !proc.client.Exited() {
+				p.mu.Unlock()
+				return proc, nil
+			}
+			lo.G.Debugf("registry: plugin %s exited, restarting", pluginpath)
+			delete(p.procs, pluginpath)
+		}
+		if pend, ok := p.starting[pluginpath]; ok {
+			p.mu.Unlock()
+			<-pend.done
+			if pend.err != nil {
+				return nil, pend.err
+			}
+			continue
+		}
+		pend := &pending{done: make(chan struct{})}
+		p.starting[pluginpath] = pend
+		p.mu.Unlock()
+
+		proc, err := p.start(pluginpath, typ)
+
+		p.mu.Lock()
+		current := p.starting[pluginpath] == pend
+		if current {
+			delete(p.starting, pluginpath)
+		}
+		switch {
+		case err != nil:
+		case p.closed:
+			p.reg.release(pluginpath, proc.client)
+			err = ErrPoolClosed
+		case !current:
+			// unregistered or refreshed while starting
+			p.reg.release(pluginpath, proc.client)
+		default:
+			p.procs[pluginpath] = proc
+		}
+		pend.err = err
+		close(pend.done)
+		p.mu.Unlock()
+
+		if err != nil {
+			return nil, err
+		}
+		if current {
+			return proc, nil
+		}
+	}
+}
+
+func (p *Pool) start(pluginpath, typ string) (*process, error) {
+	var (
+		client *plugin.Client
+		raw    interface{}
+		err    error
+	)
+	switch typ {
+	case productType:
+		client, raw, err = p.reg.getProductReference(pluginpath, p.opts.StartTimeout)
+	default:
+		client, raw, err = p.reg.getCloudConfigReference(pluginpath, p.opts.StartTimeout)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &process{typ: typ, client: client, raw: raw}, nil
+}
+
+func (p *Pool) checkHealth() {
+	ticker := time.NewTicker(p.opts.HealthInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+		}
+
+		p.mu.Lock()
+		procs := make(map[string]*process, len(p.procs))
+		for path, proc := range p.procs {
+			procs[path] = proc
+		}
+		p.mu.Unlock()
+
+		for path, proc := range procs {
+			if proc.healthy(p.opts.HealthTimeout) {
+				continue
+			}
+			lo.G.Debugf("registry: plugin %s failed its health check, restarting", path)
+			p.restart(path, proc)
+		}
+	}
+}
+
+// restart replaces proc with a new process, unless it has already
+// been replaced or removed.
+func (p *Pool) restart(pluginpath string, proc *process) {
+	p.mu.Lock()
+	p.reg.release(pluginpath, proc.client)
+	if p.closed || p.procs[pluginpath] != proc {
+		p.mu.Unlock()
+		return
+	}
+	delete(p.procs, pluginpath)
+	p.mu.Unlock()
+	if _, err := p.get(pluginpath, proc.typ); err != nil && err != ErrPoolClosed {
+		lo.G.Errorf("registry: failed to restart plugin %s: %v", pluginpath, err)
+	}
+}
+
+// Shutdown kills every plugin process started by the pool.
+// Plugins that were reattached to are left running.
+// The pool cannot be used after it is shut down.
+func (p *Pool) Shutdown() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return
+	}
+	p.closed = true
+	close(p.done)
+	p.unsubscribe()
+	for path, proc := range p.procs {
+		p.reg.release(path, proc.client)
+		delete(p.procs, path)
+	}
+}
+
+// HandleSignals shuts down the pool when the host receives one of the
+// given signals, then re-raises the signal so the host exits as it
+// normally would.  With no arguments, SIGINT and SIGTERM are handled.
+func (p *Pool) HandleSignals(sigs ...os.Signal) {
+	if len(sigs) == 0 {
+		sigs = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, sigs...)
+	go func() {
+		select {
+		case sig := <-ch:
+			signal.Stop(ch)
+			p.Shutdown()
+			reraise(sig)
+		case <-p.done:
+			signal.Stop(ch)
+		}
+	}()
+}
+
+func reraise(sig os.Signal) {
+	self, err := os.FindProcess(os.Getpid())
+	if err == nil {
+		err = self.Signal(sig)
+	}
+	if err != nil {
+		os.Exit(1)
+	}
+}
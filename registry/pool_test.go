@@ -0,0 +1,128 @@
+package registry
+
+import (
+	"runtime"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Pool", func() {
+	var (
+		reg  *Registry
+		pool *Pool
+	)
+
+	BeforeEach(func() {
+		if testing.Short() {
+			Skip("plugin registry tests skipped in short mode")
+		}
+		reg = New()
+		_, err := reg.RegisterProduct("./fixtures/product/testproductplugin-" + runtime.GOOS)
+		Ω(err).ShouldNot(HaveOccurred())
+		_, err = reg.RegisterCloudConfig("./fixtures/cloudconfig/testplugin-" + runtime.GOOS)
+		Ω(err).ShouldNot(HaveOccurred())
+		pool = NewPool(reg, PoolOptions{})
+	})
+
+	AfterEach(func() {
+		if pool != nil {
+			pool.Shutdown()
+		}
+	})
+
+	It("then it should reuse a running plugin between calls", func() {
+		first, err := pool.Product("myfakeproduct", Latest)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(first.GetMeta().Name).Should(Equal("myfakeproduct"))
+
+		second, err := pool.Product("myfakeproduct", "")
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(second).Should(BeIdenticalTo(first))
+	})
+
+	It("then it should start a plugin once for concurrent requests", func() {
+		const n = 5
+		results := make(chan interface{}, n)
+		for i := 0; i < n; i++ {
+			go func() {
+				defer GinkgoRecover()
+				d, err := pool.Product("myfakeproduct", Latest)
+				Ω(err).ShouldNot(HaveOccurred())
+				results <- d
+			}()
+		}
+		first := <-results
+		for i := 1; i < n; i++ {
+			Ω(<-results).Should(BeIdenticalTo(first))
+		}
+		Ω(pool.procs).Should(HaveLen(1))
+		Ω(pool.starting).Should(BeEmpty())
+	})
+
+	It("then it should start cloud config plugins", func() {
+		cc, err := pool.CloudConfig("myfakecloudconfig")
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(cc.GetMeta().Name).Should(Equal("myfakecloudconfig"))
+	})
+
+	It("then it should return an error for plugins that are not registered", func() {
+		_, err := pool.Product("notaproduct", Latest)
+		Ω(err).Should(BeAssignableToTypeOf(&NotFoundError{}))
+	})
+
+	It("then it should restart a plugin that has crashed", func() {
+		first, err := pool.Product("myfakeproduct", Latest)
+		Ω(err).ShouldNot(HaveOccurred())
+		for _, proc := range pool.procs {
+			proc.client.Kill()
+		}
+
+		second, err := pool.Product("myfakeproduct", Latest)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(second).ShouldNot(BeIdenticalTo(first))
+		Ω(second.GetMeta().Name).Should(Equal("myfakeproduct"))
+	})
+
+	It("then its health checks should restart a plugin that has crashed", func() {
+		pool.Shutdown()
+		pool = NewPool(reg, PoolOptions{HealthInterval: 10 * time.Millisecond})
+		_, err := pool.Product("myfakeproduct", Latest)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		pool.mu.Lock()
+		var crashed *process
+		for _, proc := range pool.procs {
+			crashed = proc
+		}
+		pool.mu.Unlock()
+		crashed.client.Kill()
+
+		Eventually(func() bool {
+			pool.mu.Lock()
+			defer pool.mu.Unlock()
+			for _, proc := range pool.procs {
+				return proc != crashed && !proc.client.Exited()
+			}
+			return false
+		}).Should(BeTrue())
+	})
+
+	It("then it should kill its plugins when shut down", func() {
+		_, err := pool.Product("myfakeproduct", Latest)
+		Ω(err).ShouldNot(HaveOccurred())
+		var procs []*process
+		for _, proc := range pool.procs {
+			procs = append(procs, proc)
+		}
+
+		pool.Shutdown()
+		for _, proc := range procs {
+			Ω(proc.client.Exited()).Should(BeTrue())
+		}
+		_, err = pool.Product("myfakeproduct", Latest)
+		Ω(err).Should(Equal(ErrPoolClosed))
+	})
+})
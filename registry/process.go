@@ -0,0 +1,140 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-plugin"
+)
+
+// ProcessOptions controls the environment that plugin processes run in.
+// The zero value runs plugins in the host's working directory with the
+// host's whole environment and no time limit.
+type ProcessOptions struct {
+	// ClearEnv stops plugins from inheriting the host's environment.
+	// Only the variables named in PassEnv, those in ExtraEnv and those
+	// needed to start the plugin are set.
+	ClearEnv bool
+
+	// PassEnv names the host environment variables passed through to
+	// plugins when ClearEnv is set.
+	PassEnv []string
+
+	// ExtraEnv holds variables, in "KEY=value" form, set for every plugin.
+	// They take precedence over the host's environment.
+	ExtraEnv []string
+
+	// Dir is the working directory of plugin processes.
+	// It defaults to the host's working directory.
+	Dir string
+
+	// MaxRuntime is how long a plugin process may run before it is
+	// killed.  Zero means no limit.
+	MaxRuntime time.Duration
+}
+
+// UseProcessOptions configures the environment of plugin processes started
+// by the registry.  It does not affect plugins that are reattached to.
+// Restricting the environment is not supported on Windows, nor for
+// plugins whose path contains "=".
+func (r *Registry) UseProcessOptions(opts ProcessOptions) {
+	r.mu.Lock()
+	r.process = opts
+	r.mu.Unlock()
+}
+
+// UseProcessOptions configures plugin processes for the default registry.
+func UseProcessOptions(opts ProcessOptions) {
+	defaultRegistry.UseProcessOptions(opts)
+}
+
+func (r *Registry) processOptions() ProcessOptions {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.process
+}
+
+// goPluginEnv names the variables go-plugin sets for the plugins it
+// starts.  They must not be removed when the environment is restricted.
+var goPluginEnv = []string{
+	"PLUGIN_MIN_PORT",
+	"PLUGIN_MAX_PORT",
+	"PLUGIN_PROTOCOL_VERSIONS",
+	"PLUGIN_CLIENT_CERT",
+}
+
+// command returns the command that runs the plugin at pluginpath.
+//
+// go-plugin always appends the host's environment to the command's, so
+// when the environment is restricted the plugin is run through env(1),
+// which removes the variables the plugin may not see and sets the extra
+// ones after go-plugin has added its own.
+func command(pluginpath string, handshake plugin.HandshakeConfig, opts ProcessOptions) (*exec.Cmd, error) {
+	// a relative path would be resolved against opts.Dir
+	pluginpath, err := filepath.Abs(pluginpath)
+	if err != nil {
+		return nil, err
+	}
+
+	var cmd *exec.Cmd
+	if !opts.ClearEnv && len(opts.ExtraEnv) == 0 {
+		cmd = exec.Command(pluginpath, "plugin")
+	} else {
+		if runtime.GOOS == "windows" {
+			return nil, errors.New("restricting the environment of plugins is not supported on windows")
+		}
+		env, err := exec.LookPath("env")
+		if err != nil {
+			return nil, err
+		}
+
+		// env(1) takes any argument containing "=" for a variable, and
+		// has no way to mark where the command starts
+		if strings.Contains(pluginpath, "=") {
+			return nil, fmt.Errorf("cannot restrict the environment of %s: its path contains \"=\"", pluginpath)
+		}
+		for _, kv := range opts.ExtraEnv {
+			if !strings.Contains(kv, "=") || strings.HasPrefix(kv, "=") || strings.HasPrefix(kv, "-") {
+				return nil, fmt.Errorf("invalid environment variable %q", kv)
+			}
+		}
+
+		var args []string
+		if opts.ClearEnv {
+			keep := map[string]bool{
+				handshake.MagicCookieKey: true,
+			}
+			for _, name := range goPluginEnv {
+				keep[name] = true
+			}
+			for _, name := range opts.PassEnv {
+				keep[name] = true
+			}
+			for _, kv := range os.Environ() {
+				name := strings.SplitN(kv, "=", 2)[0]
+				if name == "" || keep[name] {
+					continue
+				}
+				args = append(args, "-u", name)
+			}
+		}
+		args = append(args, opts.ExtraEnv...)
+		args = append(args, pluginpath, "plugin")
+		cmd = exec.Command(env, args...)
+	}
+	cmd.Dir = opts.Dir
+	return cmd, nil
+}
+
+// limitRuntime kills client once it has run for the given time.
+func limitRuntime(client *plugin.Client, max time.Duration) {
+	if max > 0 {
+		time.AfterFunc(max, client.Kill)
+	}
+}
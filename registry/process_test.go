@@ -0,0 +1,126 @@
+package registry_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	. "github.com/enaml-ops/pluginlib/registry"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("plugin process options", func() {
+	var (
+		dir string
+		reg *Registry
+	)
+
+	BeforeEach(func() {
+		if testing.Short() {
+			Skip("plugin registry tests skipped in short mode")
+		}
+		if runtime.GOOS == "windows" {
+			Skip("restricting the environment is not supported on windows")
+		}
+		var err error
+		dir, err = ioutil.TempDir("", "registry-process")
+		Ω(err).ShouldNot(HaveOccurred())
+		reg = New()
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+		os.Unsetenv("REGISTRY_TEST_SECRET")
+		os.Unsetenv("REGISTRY_TEST_ALLOWED")
+		os.Unsetenv("PLUGIN_TEST_SECRET")
+	})
+
+	Context("when the environment is restricted", func() {
+		var dump string
+
+		BeforeEach(func() {
+			// the plugin records its environment and working directory
+			// and exits without serving
+			pluginpath := filepath.Join(dir, "envplugin")
+			Ω(ioutil.WriteFile(pluginpath, []byte("#!/bin/sh\nenv > \"$ENV_DUMP\"\necho \"PWD=$(pwd)\" >> \"$ENV_DUMP\"\nexit 1\n"), 0755)).Should(Succeed())
+			dump = filepath.Join(dir, "env")
+
+			os.Setenv("REGISTRY_TEST_SECRET", "vault-token")
+			os.Setenv("REGISTRY_TEST_ALLOWED", "yes")
+			os.Setenv("PLUGIN_TEST_SECRET", "vault-token")
+			reg.UseProcessOptions(ProcessOptions{
+				ClearEnv: true,
+				PassEnv:  []string{"REGISTRY_TEST_ALLOWED"},
+				ExtraEnv: []string{"ENV_DUMP=" + dump},
+				Dir:      dir,
+			})
+			_, err := reg.RegisterProduct(pluginpath)
+			Ω(err).Should(HaveOccurred())
+		})
+
+		It("then it should only pass allowed and injected variables to the plugin", func() {
+			env := string(readFixture(dump))
+			Ω(env).ShouldNot(ContainSubstring("REGISTRY_TEST_SECRET"))
+			Ω(env).ShouldNot(ContainSubstring("PLUGIN_TEST_SECRET"))
+			Ω(env).Should(ContainSubstring("PLUGIN_MIN_PORT="))
+			Ω(env).Should(ContainSubstring("REGISTRY_TEST_ALLOWED=yes"))
+			Ω(env).Should(ContainSubstring("ENV_DUMP=" + dump))
+			Ω(env).Should(ContainSubstring("BASIC_PLUGIN=hello"))
+		})
+
+		It("then it should run the plugin in the configured directory", func() {
+			resolved, err := filepath.EvalSymlinks(dir)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(string(readFixture(dump))).Should(MatchRegexp("PWD=(" + dir + "|" + resolved + ")\n"))
+		})
+	})
+
+	It("then it should still start plugins with a restricted environment", func() {
+		reg.UseProcessOptions(ProcessOptions{ClearEnv: true})
+		_, err := reg.RegisterProduct("./fixtures/product/testproductplugin-" + runtime.GOOS)
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	It("then it should start plugins given by a relative path in another directory", func() {
+		reg.UseProcessOptions(ProcessOptions{Dir: dir})
+		_, err := reg.RegisterProduct("./fixtures/product/testproductplugin-" + runtime.GOOS)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		reg.UseProcessOptions(ProcessOptions{ClearEnv: true, Dir: dir})
+		_, err = reg.RegisterCloudConfig("./fixtures/cloudconfig/testplugin-" + runtime.GOOS)
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	It("then it should reject malformed extra variables", func() {
+		reg.UseProcessOptions(ProcessOptions{ExtraEnv: []string{"-i"}})
+		_, err := reg.RegisterProduct("./fixtures/product/testproductplugin-" + runtime.GOOS)
+		Ω(IsPluginError(err, ErrStartup)).Should(BeTrue())
+	})
+
+	It("then it should refuse to restrict the environment of plugins whose path contains =", func() {
+		pluginpath := filepath.Join(dir, "a=b", "testproductplugin")
+		Ω(os.MkdirAll(filepath.Dir(pluginpath), 0755)).Should(Succeed())
+		Ω(ioutil.WriteFile(pluginpath, readFixture("./fixtures/product/testproductplugin-"+runtime.GOOS), 0755)).Should(Succeed())
+
+		reg.UseProcessOptions(ProcessOptions{ClearEnv: true})
+		_, err := reg.RegisterProduct(pluginpath)
+		Ω(IsPluginError(err, ErrStartup)).Should(BeTrue())
+		Ω(err.Error()).Should(ContainSubstring(`path contains "="`))
+
+		reg.UseProcessOptions(ProcessOptions{})
+		_, err = reg.RegisterProduct(pluginpath)
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	It("then it should kill plugins that run longer than the maximum runtime", func() {
+		reg.UseProcessOptions(ProcessOptions{MaxRuntime: 200 * time.Millisecond})
+		client, _, err := reg.GetProductReference("./fixtures/product/testproductplugin-" + runtime.GOOS)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(client.Exited()).Should(BeFalse())
+		Eventually(client.Exited, 5*time.Second).Should(BeTrue())
+	})
+})
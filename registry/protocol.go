@@ -0,0 +1,94 @@
+package registry
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/enaml-ops/pluginlib/cloudconfigv1"
+	"github.com/enaml-ops/pluginlib/productv1"
+	productv2 "github.com/enaml-ops/pluginlib/productv2"
+	"github.com/hashicorp/go-plugin"
+)
+
+// protocol is one version of a plugin interface that the host can speak.
+type protocol struct {
+	handshake plugin.HandshakeConfig
+	name      string
+	plugin    plugin.Plugin
+}
+
+// productProtocols lists the versions of the product plugin interface the
+// host supports.  Each dispenses a product.Deployer or a productv2.Deployer.
+var productProtocols = []protocol{
+	{handshake: product.HandshakeConfig, name: product.PluginsMapHash, plugin: new(product.Plugin)},
+	{handshake: productv2.HandshakeConfig, name: productv2.PluginsMapHash, plugin: new(productv2.Plugin)},
+}
+
+// cloudConfigProtocols lists the versions of the cloud config plugin
+// interface the host supports.  Each dispenses a cloudconfig.Deployer.
+var cloudConfigProtocols = []protocol{
+	{handshake: cloudconfig.HandshakeConfig, name: cloudconfig.PluginsMapHash, plugin: new(cloudconfig.Plugin)},
+}
+
+// newest returns the protocols sorted from the newest version to the oldest.
+func newest(protocols []protocol) []protocol {
+	res := append([]protocol(nil), protocols...)
+	sort.Sort(byProtocolVersion(res))
+	return res
+}
+
+// find returns the protocol with the given version.
+func find(protocols []protocol, version uint) (protocol, bool) {
+	for _, p := range protocols {
+		if p.handshake.ProtocolVersion == version {
+			return p, true
+		}
+	}
+	return protocol{}, false
+}
+
+// versionedPlugins returns protocols keyed by version for go-plugin, which
+// offers them all to the plugin so that it can pick the newest one it
+// speaks.
+func versionedPlugins(protocols []protocol) map[int]plugin.PluginSet {
+	sets := make(map[int]plugin.PluginSet, len(protocols))
+	for _, p := range protocols {
+		sets[int(p.handshake.ProtocolVersion)] = plugin.PluginSet{p.name: p.plugin}
+	}
+	return sets
+}
+
+// protocolVersions formats the supported versions, such as "3,2".
+func protocolVersions(protocols []protocol) string {
+	var versions []string
+	for _, p := range newest(protocols) {
+		versions = append(versions, strconv.FormatUint(uint64(p.handshake.ProtocolVersion), 10))
+	}
+	return strings.Join(versions, ",")
+}
+
+// mismatch explains why a plugin speaking version could not be loaded by
+// a host that supports protocols.
+func mismatch(pluginpath string, version uint, protocols []protocol) *PluginError {
+	sorted := newest(protocols)
+	max := sorted[0].handshake.ProtocolVersion
+	min := sorted[len(sorted)-1].handshake.ProtocolVersion
+	err := fmt.Errorf("plugin speaks protocol version %d, host supports %s", version, protocolVersions(protocols))
+	switch {
+	case version > max:
+		return &PluginError{Path: pluginpath, Kind: ErrTooNew, Err: err}
+	case version < min:
+		return &PluginError{Path: pluginpath, Kind: ErrTooOld, Err: err}
+	}
+	return &PluginError{Path: pluginpath, Kind: ErrHandshake, Err: err}
+}
+
+type byProtocolVersion []protocol
+
+func (s byProtocolVersion) Len() int      { return len(s) }
+func (s byProtocolVersion) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byProtocolVersion) Less(i, j int) bool {
+	return s[i].handshake.ProtocolVersion > s[j].handshake.ProtocolVersion
+}
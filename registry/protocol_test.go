@@ -0,0 +1,214 @@
+package registry
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/enaml-ops/pluginlib/productv1"
+	"github.com/hashicorp/go-plugin"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("protocol negotiation", func() {
+	withVersion := func(version uint) protocol {
+		handshake := product.HandshakeConfig
+		handshake.ProtocolVersion = version
+		return protocol{handshake: handshake, name: product.PluginsMapHash, plugin: new(product.Plugin)}
+	}
+
+	It("then it should list supported versions from newest to oldest", func() {
+		Ω(protocolVersions([]protocol{withVersion(2), withVersion(4), withVersion(3)})).Should(Equal("4,3,2"))
+	})
+
+	It("then it should explain why a version is not supported", func() {
+		protocols := []protocol{withVersion(3), withVersion(5)}
+		Ω(mismatch("p", 2, protocols).Kind).Should(Equal(ErrTooOld))
+		Ω(mismatch("p", 6, protocols).Kind).Should(Equal(ErrTooNew))
+		Ω(mismatch("p", 4, protocols).Kind).Should(Equal(ErrHandshake))
+		Ω(mismatch("p", 6, protocols).Error()).Should(ContainSubstring("host supports 5,3"))
+	})
+
+	Context("when loading a plugin that speaks protocol version 2", func() {
+		var saved []protocol
+
+		BeforeEach(func() {
+			if testing.Short() {
+				Skip("plugin registry tests skipped in short mode")
+			}
+			saved = productProtocols
+		})
+
+		AfterEach(func() {
+			productProtocols = saved
+		})
+
+		load := func() (*plugin.Client, error) {
+			client, _, err := New().GetProductReference("./fixtures/product/testproductplugin-" + runtime.GOOS)
+			return client, err
+		}
+
+		It("then it should settle on version 2 when the host also speaks newer versions", func() {
+			productProtocols = []protocol{withVersion(2), withVersion(3)}
+			client, err := load()
+			Ω(err).ShouldNot(HaveOccurred())
+			client.Kill()
+		})
+
+		It("then it should report a handshake error when the host only speaks newer versions", func() {
+			productProtocols = []protocol{withVersion(3), withVersion(4)}
+			_, err := load()
+			Ω(IsPluginError(err, ErrHandshake)).Should(BeTrue())
+			Ω(err.Error()).Should(ContainSubstring("host supports protocol versions 4,3"))
+		})
+
+		It("then it should report a handshake error when the host only speaks older versions", func() {
+			productProtocols = []protocol{withVersion(1)}
+			_, err := load()
+			Ω(IsPluginError(err, ErrHandshake)).Should(BeTrue())
+		})
+	})
+
+	Context("when loading a plugin that speaks protocol versions 2 and 3", func() {
+		var saved []protocol
+
+		BeforeEach(func() {
+			if testing.Short() {
+				Skip("plugin registry tests skipped in short mode")
+			}
+			saved = productProtocols
+		})
+
+		AfterEach(func() {
+			productProtocols = saved
+		})
+
+		pluginpath := "./fixtures/productv2/testproductplugin-" + runtime.GOOS
+
+		It("then it should settle on version 3 when the host speaks both", func() {
+			reg := New()
+			client, p, err := reg.GetProductReferenceV2(pluginpath)
+			Ω(err).ShouldNot(HaveOccurred())
+			defer client.Kill()
+			Ω(client.NegotiatedVersion()).Should(Equal(3))
+			Ω(reg.protocolVersion(pluginpath)).Should(Equal(uint(3)))
+			meta, err := p.GetMeta(context.Background())
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(meta.Name).Should(Equal("myfakeproductv2"))
+		})
+
+		It("then it should settle on version 2 when the host only speaks version 2", func() {
+			productProtocols = []protocol{withVersion(2)}
+			client, p, err := New().GetProductReference(pluginpath)
+			Ω(err).ShouldNot(HaveOccurred())
+			defer client.Kill()
+			Ω(client.NegotiatedVersion()).Should(Equal(2))
+			Ω(p.GetMeta().Name).Should(Equal("myfakeproductv2"))
+		})
+	})
+
+	Context("when loading a plugin for the first time", func() {
+		var (
+			dir    string
+			starts string
+		)
+
+		BeforeEach(func() {
+			if testing.Short() {
+				Skip("plugin registry tests skipped in short mode")
+			}
+			var err error
+			dir, err = ioutil.TempDir("", "registry-protocol")
+			Ω(err).ShouldNot(HaveOccurred())
+			starts = filepath.Join(dir, "starts")
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		// counting wraps fixture in a script that records each start
+		counting := func(fixture string) string {
+			abs, err := filepath.Abs(fixture)
+			Ω(err).ShouldNot(HaveOccurred())
+			wrapper := filepath.Join(dir, "plugin")
+			script := "#!/bin/sh\necho start >> " + starts + "\nexec " + abs + " \"$@\"\n"
+			Ω(ioutil.WriteFile(wrapper, []byte(script), 0755)).Should(Succeed())
+			return wrapper
+		}
+
+		countStarts := func() int {
+			b, err := ioutil.ReadFile(starts)
+			Ω(err).ShouldNot(HaveOccurred())
+			return strings.Count(string(b), "start")
+		}
+
+		It("then it should start a V1 plugin once", func() {
+			if runtime.GOOS == "windows" {
+				Skip("the wrapper script needs a shell")
+			}
+			client, _, err := New().GetProductReference(counting("./fixtures/product/testproductplugin-" + runtime.GOOS))
+			Ω(err).ShouldNot(HaveOccurred())
+			client.Kill()
+			Ω(countStarts()).Should(Equal(1))
+		})
+
+		It("then it should start a V2 plugin once", func() {
+			if runtime.GOOS == "windows" {
+				Skip("the wrapper script needs a shell")
+			}
+			client, _, err := New().GetProductReferenceV2(counting("./fixtures/productv2/testproductplugin-" + runtime.GOOS))
+			Ω(err).ShouldNot(HaveOccurred())
+			client.Kill()
+			Ω(countStarts()).Should(Equal(1))
+		})
+
+		It("then it should start a V2 plugin once when the cache knows its protocol", func() {
+			if runtime.GOOS == "windows" {
+				Skip("the wrapper script needs a shell")
+			}
+			pluginpath := counting("./fixtures/productv2/testproductplugin-" + runtime.GOOS)
+			cache, err := OpenCache(filepath.Join(dir, "cache.json"))
+			Ω(err).ShouldNot(HaveOccurred())
+			first := New()
+			first.UseCache(cache)
+			_, err = first.RegisterProduct(pluginpath)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(os.Remove(starts)).Should(Succeed())
+
+			reg := New()
+			reg.UseCache(cache)
+			_, err = reg.RegisterProduct(pluginpath)
+			Ω(err).ShouldNot(HaveOccurred())
+			client, _, err := reg.GetProductReferenceV2(pluginpath)
+			Ω(err).ShouldNot(HaveOccurred())
+			client.Kill()
+			Ω(countStarts()).Should(Equal(1))
+		})
+
+		It("then it should start a V2 plugin once when its manifest lists its protocol", func() {
+			if runtime.GOOS == "windows" {
+				Skip("the wrapper script needs a shell")
+			}
+			pluginpath := counting("./fixtures/productv2/testproductplugin-" + runtime.GOOS)
+			manifest := "type: product\nname: myfakeproductv2\nversion: 2.0.0\nprotocol_versions: [3]\n"
+			Ω(ioutil.WriteFile(pluginpath+".yml", []byte(manifest), 0644)).Should(Succeed())
+
+			reg := New()
+			_, err := reg.RegisterProduct(pluginpath)
+			Ω(err).ShouldNot(HaveOccurred())
+			_, err = os.Stat(starts)
+			Ω(os.IsNotExist(err)).Should(BeTrue())
+
+			client, _, err := reg.GetProductReferenceV2(pluginpath)
+			Ω(err).ShouldNot(HaveOccurred())
+			client.Kill()
+			Ω(countStarts()).Should(Equal(1))
+		})
+	})
+})
@@ -0,0 +1,152 @@
+package registry
+
+import (
+	"fmt"
+	"path"
+	"reflect"
+	"sort"
+)
+
+// Matcher reports whether a record should be included in query results.
+type Matcher func(Record) bool
+
+// PropertyEquals matches records whose property key has the given value.
+// Values are compared by their string form when they are not deeply equal,
+// so that 2 matches a property read back from the cache as 2.0.
+func PropertyEquals(key string, value interface{}) Matcher {
+	return func(r Record) bool {
+		v, ok := r.Properties[key]
+		if !ok {
+			return false
+		}
+		return reflect.DeepEqual(v, value) || fmt.Sprint(v) == fmt.Sprint(value)
+	}
+}
+
+// HasProperty matches records that have the property key.
+func HasProperty(key string) Matcher {
+	return func(r Record) bool {
+		_, ok := r.Properties[key]
+		return ok
+	}
+}
+
+// NameGlob matches records whose name matches a shell pattern
+// such as "p-*", using the syntax of path.Match.
+func NameGlob(pattern string) Matcher {
+	return func(r Record) bool {
+		ok, err := path.Match(pattern, r.Name)
+		return err == nil && ok
+	}
+}
+
+// VersionInRange matches records whose version falls within rng, for
+// example ">=1.2.0 <2.0.0", "~1.4", "^2.0.0" or "1.x || 3.x".
+// key names the property holding the version; when key is empty the
+// record's own Version is used.  Records without a valid version
+// never match.
+func VersionInRange(key, rng string) (Matcher, error) {
+	vr, err := parseRange(rng)
+	if err != nil {
+		return nil, err
+	}
+	return func(r Record) bool {
+		if key == "" {
+			return vr.contains(r.Version)
+		}
+		v, ok := r.Properties[key]
+		return ok && vr.contains(fmt.Sprint(v))
+	}, nil
+}
+
+// SupportsIaaS matches products that can be deployed to iaas, including
+// those that do not list any IaaS types.
+func SupportsIaaS(iaas string) Matcher {
+	return func(r Record) bool {
+		if len(r.IaaS) == 0 {
+			return true
+		}
+		for _, i := range r.IaaS {
+			if i == iaas {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// DependsOn matches products that list the product called name as a
+// dependency.
+func DependsOn(name string) Matcher {
+	return func(r Record) bool {
+		for _, d := range r.Dependencies {
+			if d.Name == name {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// FindProducts returns every registered product, including every
+// version, that satisfies all of the matchers.
+// The results are sorted by name and then by version.
+func (r *Registry) FindProducts(matchers ...Matcher) []Record {
+	r.mu.RLock()
+	var res []Record
+	for _, versions := range r.products {
+		for _, record := range versions {
+			if matchAll(record, matchers) {
+				res = append(res, record.copy())
+			}
+		}
+	}
+	r.mu.RUnlock()
+	sort.Sort(byNameAndVersion(res))
+	return res
+}
+
+// FindCloudConfigs returns every registered cloud config plugin that
+// satisfies all of the matchers, sorted by name.
+func (r *Registry) FindCloudConfigs(matchers ...Matcher) []Record {
+	r.mu.RLock()
+	var res []Record
+	for _, record := range r.cloudconfigs {
+		if matchAll(record, matchers) {
+			res = append(res, record.copy())
+		}
+	}
+	r.mu.RUnlock()
+	sort.Sort(byNameAndVersion(res))
+	return res
+}
+
+// FindProducts queries the products in the default registry.
+func FindProducts(matchers ...Matcher) []Record {
+	return defaultRegistry.FindProducts(matchers...)
+}
+
+// FindCloudConfigs queries the cloud config plugins in the default registry.
+func FindCloudConfigs(matchers ...Matcher) []Record {
+	return defaultRegistry.FindCloudConfigs(matchers...)
+}
+
+func matchAll(r Record, matchers []Matcher) bool {
+	for _, m := range matchers {
+		if !m(r) {
+			return false
+		}
+	}
+	return true
+}
+
+type byNameAndVersion []Record
+
+func (s byNameAndVersion) Len() int      { return len(s) }
+func (s byNameAndVersion) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byNameAndVersion) Less(i, j int) bool {
+	if s[i].Name != s[j].Name {
+		return s[i].Name < s[j].Name
+	}
+	return compareVersions(s[i].Version, s[j].Version) < 0
+}
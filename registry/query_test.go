@@ -0,0 +1,112 @@
+package registry
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("registry queries", func() {
+	var reg *Registry
+
+	names := func(records []Record) []string {
+		var res []string
+		for _, r := range records {
+			res = append(res, r.Name+"@"+r.Version)
+		}
+		return res
+	}
+
+	BeforeEach(func() {
+		reg = New()
+		reg.addProduct(Record{Name: "p-redis", Version: "1.7.2", Properties: map[string]interface{}{
+			"iaas": "vsphere", "stemcell": "3263.8",
+		}})
+		reg.addProduct(Record{Name: "p-mysql", Version: "1.10.0", Properties: map[string]interface{}{
+			"iaas": "vsphere", "ha": true,
+		}})
+		reg.addProduct(Record{Name: "p-mysql", Version: "1.9.0", Properties: map[string]interface{}{
+			"iaas": "aws",
+		}})
+		reg.addProduct(Record{Name: "concourse", Version: "2.4.0", Properties: map[string]interface{}{
+			"iaas": "aws", "stemcell": "3263.10",
+		}})
+		reg.addCloudConfig(Record{Name: "vsphere", Properties: map[string]interface{}{"iaas": "vsphere"}})
+		reg.addCloudConfig(Record{Name: "aws", Properties: map[string]interface{}{"iaas": "aws"}})
+	})
+
+	It("returns every product in sorted order when given no matchers", func() {
+		Ω(names(reg.FindProducts())).Should(Equal([]string{
+			"concourse@2.4.0", "p-mysql@1.9.0", "p-mysql@1.10.0", "p-redis@1.7.2",
+		}))
+	})
+
+	It("filters by property value", func() {
+		Ω(names(reg.FindProducts(PropertyEquals("iaas", "vsphere")))).Should(Equal([]string{
+			"p-mysql@1.10.0", "p-redis@1.7.2",
+		}))
+		Ω(names(reg.FindProducts(PropertyEquals("ha", true)))).Should(Equal([]string{"p-mysql@1.10.0"}))
+		Ω(names(reg.FindProducts(PropertyEquals("ha", "true")))).Should(Equal([]string{"p-mysql@1.10.0"}))
+	})
+
+	It("filters by property existence", func() {
+		Ω(names(reg.FindProducts(HasProperty("stemcell")))).Should(Equal([]string{
+			"concourse@2.4.0", "p-redis@1.7.2",
+		}))
+	})
+
+	It("filters by name glob", func() {
+		Ω(names(reg.FindProducts(NameGlob("p-*"), PropertyEquals("iaas", "aws")))).Should(Equal([]string{
+			"p-mysql@1.9.0",
+		}))
+	})
+
+	It("filters by version range", func() {
+		m, err := VersionInRange("", ">=1.9.0 <2.0.0")
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(names(reg.FindProducts(m))).Should(Equal([]string{
+			"p-mysql@1.9.0", "p-mysql@1.10.0",
+		}))
+
+		m, err = VersionInRange("", "~1.7 || ^2.0.0")
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(names(reg.FindProducts(m))).Should(Equal([]string{
+			"concourse@2.4.0", "p-redis@1.7.2",
+		}))
+
+		m, err = VersionInRange("", "1.x")
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(reg.FindProducts(m)).Should(HaveLen(3))
+	})
+
+	It("filters by a version range on a property", func() {
+		m, err := VersionInRange("stemcell", ">3263.8")
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(names(reg.FindProducts(m))).Should(Equal([]string{"concourse@2.4.0"}))
+	})
+
+	It("returns an error for an invalid version range", func() {
+		_, err := VersionInRange("", ">=banana")
+		Ω(err).Should(HaveOccurred())
+		_, err = VersionInRange("", "")
+		Ω(err).Should(HaveOccurred())
+	})
+
+	It("filters by IaaS and dependencies", func() {
+		reg.addProduct(Record{Name: "p-rabbitmq", Version: "1.8.0", IaaS: []string{"aws", "gcp"},
+			Dependencies: []Dependency{{Name: "cf"}}})
+		reg.addProduct(Record{Name: "p-spring-cloud", Version: "1.3.0", IaaS: []string{"vsphere"},
+			Dependencies: []Dependency{{Name: "cf"}, {Name: "p-rabbitmq", Version: ">=1.8.0"}}})
+
+		Ω(names(reg.FindProducts(SupportsIaaS("gcp"), NameGlob("p-*")))).Should(Equal([]string{
+			"p-mysql@1.9.0", "p-mysql@1.10.0", "p-rabbitmq@1.8.0", "p-redis@1.7.2",
+		}))
+		Ω(names(reg.FindProducts(DependsOn("cf")))).Should(Equal([]string{
+			"p-rabbitmq@1.8.0", "p-spring-cloud@1.3.0",
+		}))
+		Ω(names(reg.FindProducts(DependsOn("p-rabbitmq")))).Should(Equal([]string{"p-spring-cloud@1.3.0"}))
+	})
+
+	It("queries cloud configs", func() {
+		Ω(names(reg.FindCloudConfigs(PropertyEquals("iaas", "aws")))).Should(Equal([]string{"aws@"}))
+	})
+})
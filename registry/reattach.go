@@ -0,0 +1,132 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/hashicorp/go-plugin"
+)
+
+// ReattachEnv names the environment variable that holds reattach settings
+// as a JSON object keyed by plugin name or path, for example
+//
+//	{"myproduct": {"Network": "tcp", "Addr": "127.0.0.1:1234", "Pid": 4242}}
+//
+// Settings passed to UseReattach take precedence over the environment.
+const ReattachEnv = "ENAML_PLUGIN_REATTACH"
+
+// ReattachConfig describes a plugin process that is already running, such
+// as one started under a debugger, that the registry should connect to
+// instead of starting the plugin itself.
+//
+// A plugin prints its address on startup in the form
+// "1|2|tcp|127.0.0.1:1234|netrpc", where the second field is the protocol
+// version and the third and fourth are the network and the address.
+type ReattachConfig struct {
+	// Network is "tcp" or "unix".  It defaults to "tcp".
+	Network string
+	// Addr is the address the plugin is listening on.
+	Addr string
+	// Pid is the plugin's process ID.
+	Pid int
+	// ProtocolVersion is the protocol version the plugin speaks, which is
+	// the second field of the line it prints.  When it is zero the oldest
+	// version the host supports is assumed.
+	ProtocolVersion uint
+}
+
+// UseReattach makes the registry connect to the running plugin described
+// by c whenever it would otherwise start the plugin named by key.
+// key is either a plugin's path or its registered name.
+// The binary at the plugin's path is neither checked nor verified.
+// The registry leaves the plugin running when it is done with it, but
+// killing a client returned by GetProductReference also kills the plugin.
+func (r *Registry) UseReattach(key string, c ReattachConfig) {
+	r.mu.Lock()
+	if r.reattach == nil {
+		r.reattach = make(map[string]ReattachConfig)
+	}
+	r.reattach[key] = c
+	r.mu.Unlock()
+}
+
+// UseReattach sets reattach settings for the default registry.
+func UseReattach(key string, c ReattachConfig) {
+	defaultRegistry.UseReattach(key, c)
+}
+
+// reattachConfig returns the settings for reattaching to the plugin at
+// pluginpath, or nil when the plugin should be started.
+func (r *Registry) reattachConfig(pluginpath string) (*ReattachConfig, error) {
+	name := r.pluginName(pluginpath)
+
+	r.mu.RLock()
+	c, ok := r.reattach[pluginpath]
+	if !ok {
+		c, ok = r.reattach[name]
+	}
+	r.mu.RUnlock()
+
+	if !ok {
+		env, err := reattachFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		c, ok = env[pluginpath]
+		if !ok {
+			c, ok = env[name]
+		}
+	}
+	if !ok {
+		return nil, nil
+	}
+	return &c, nil
+}
+
+// release is called when the registry is done with client, the plugin at
+// pluginpath.  A plugin that was reattached to is left running, since the
+// registry did not start it; go-plugin cannot close the connection without
+// telling the plugin to exit, so the connection is left open.
+// Any other plugin is killed.
+func (r *Registry) release(pluginpath string, client *plugin.Client) {
+	if c, _ := r.reattachConfig(pluginpath); c != nil {
+		return
+	}
+	client.Kill()
+}
+
+func reattachFromEnv() (map[string]ReattachConfig, error) {
+	s := os.Getenv(ReattachEnv)
+	if s == "" {
+		return nil, nil
+	}
+	var env map[string]ReattachConfig
+	if err := json.Unmarshal([]byte(s), &env); err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", ReattachEnv, err)
+	}
+	return env, nil
+}
+
+func (c ReattachConfig) resolve() (*plugin.ReattachConfig, error) {
+	var (
+		addr net.Addr
+		err  error
+	)
+	switch c.Network {
+	case "", "tcp":
+		addr, err = net.ResolveTCPAddr("tcp", c.Addr)
+	case "unix":
+		addr, err = net.ResolveUnixAddr("unix", c.Addr)
+	default:
+		err = fmt.Errorf("unsupported network %q", c.Network)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid reattach address: %v", err)
+	}
+	if c.Pid <= 0 {
+		return nil, fmt.Errorf("invalid reattach pid %d", c.Pid)
+	}
+	return &plugin.ReattachConfig{Addr: addr, Pid: c.Pid}, nil
+}
@@ -0,0 +1,110 @@
+package registry_test
+
+import (
+	"bufio"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+
+	. "github.com/enaml-ops/pluginlib/registry"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("given a plugin that is already running", func() {
+	var (
+		cmd      *exec.Cmd
+		exited   chan struct{}
+		reattach ReattachConfig
+	)
+
+	BeforeEach(func() {
+		if testing.Short() {
+			Skip("plugin registry tests skipped in short mode")
+		}
+		cmd = exec.Command("./fixtures/product/testproductplugin-"+runtime.GOOS, "plugin")
+		cmd.Env = append(os.Environ(), "BASIC_PLUGIN=hello")
+		stdout, err := cmd.StdoutPipe()
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(cmd.Start()).Should(Succeed())
+
+		// reap the plugin as soon as it exits, as a debugger would,
+		// so that go-plugin sees it go away
+		exited = make(chan struct{})
+		go func() {
+			cmd.Wait()
+			close(exited)
+		}()
+
+		line, err := bufio.NewReader(stdout).ReadString('\n')
+		Ω(err).ShouldNot(HaveOccurred())
+		parts := strings.Split(strings.TrimSpace(line), "|")
+		Ω(len(parts)).Should(BeNumerically(">=", 4))
+		reattach = ReattachConfig{Network: parts[2], Addr: parts[3], Pid: cmd.Process.Pid}
+	})
+
+	AfterEach(func() {
+		if exited != nil {
+			cmd.Process.Kill()
+			<-exited
+		}
+	})
+
+	Context("when the registry is configured to reattach to it by path", func() {
+		It("then it should connect to the running process instead of starting one", func() {
+			reg := New()
+			reg.UseReattach("./fixtures/product/testproductplugin-"+runtime.GOOS, reattach)
+			client, p, err := reg.GetProductReference("./fixtures/product/testproductplugin-" + runtime.GOOS)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(p.GetMeta().Name).Should(Equal("myfakeproduct"))
+			Ω(client.Exited()).Should(BeFalse())
+		})
+	})
+
+	Context("when a plugin that was reattached to is registered", func() {
+		It("then it should leave the plugin running for later use", func() {
+			pluginpath := "./fixtures/product/testproductplugin-" + runtime.GOOS
+			reg := New()
+			reg.UseReattach(pluginpath, reattach)
+			_, err := reg.RegisterProduct(pluginpath)
+			Ω(err).ShouldNot(HaveOccurred())
+			Consistently(exited, "200ms").ShouldNot(BeClosed())
+
+			pool := NewPool(reg, PoolOptions{})
+			p, err := pool.Product("myfakeproduct", "")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(p.GetMeta().Name).Should(Equal("myfakeproduct"))
+			pool.Shutdown()
+			Consistently(exited, "200ms").ShouldNot(BeClosed())
+
+			_, p, err = reg.GetProductReference(pluginpath)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(p.GetMeta().Name).Should(Equal("myfakeproduct"))
+		})
+	})
+
+	Context("when the reattach settings come from the environment", func() {
+		AfterEach(func() {
+			os.Unsetenv(ReattachEnv)
+		})
+
+		It("then it should reattach even if the binary does not exist", func() {
+			os.Setenv(ReattachEnv, `{"./does-not-exist": {"Network": "`+reattach.Network+`", "Addr": "`+reattach.Addr+`", "Pid": `+strconv.Itoa(reattach.Pid)+`}}`)
+			reg := New()
+			_, err := reg.RegisterProduct("./does-not-exist")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(reg.ListProducts()).Should(HaveKey("myfakeproduct"))
+		})
+
+		It("then it should return an error for malformed settings", func() {
+			os.Setenv(ReattachEnv, "not json")
+			reg := New()
+			_, _, err := reg.GetProductReference("./fixtures/product/testproductplugin-" + runtime.GOOS)
+			Ω(err).Should(HaveOccurred())
+			Ω(IsPluginError(err, ErrStartup)).Should(BeTrue())
+		})
+	})
+})
@@ -1,104 +1,431 @@
 package registry
 
 import (
-	"log"
-	"os/exec"
+	"sort"
+	"sync"
 
 	"github.com/enaml-ops/pluginlib/cloudconfigv1"
 	"github.com/enaml-ops/pluginlib/pcli"
 	"github.com/enaml-ops/pluginlib/productv1"
-	"github.com/hashicorp/go-plugin"
-	"github.com/xchapter7x/lo"
 )
 
-var (
+// Registry tracks the product and cloud config plugins available to a host.
+// A Registry is safe for use by multiple goroutines.
+type Registry struct {
+	mu           sync.RWMutex
 	cloudconfigs map[string]Record
-	products     map[string]Record
-)
+	products     map[string]map[string]Record // name -> version -> record
+	cache        *Cache
+	verifier     Verifier
+	logging      LogOptions
+	reattach     map[string]ReattachConfig
+	process      ProcessOptions
+	versions     map[string]uint // path -> protocol version last spoken
+
+	subMu       sync.Mutex
+	subscribers map[int]func(Event)
+	nextSubID   int
+}
 
-func init() {
-	cloudconfigs = make(map[string]Record)
-	products = make(map[string]Record)
+// New creates an empty Registry.
+func New() *Registry {
+	return &Registry{
+		cloudconfigs: make(map[string]Record),
+		products:     make(map[string]map[string]Record),
+		versions:     make(map[string]uint),
+		subscribers:  make(map[int]func(Event)),
+	}
 }
 
+// defaultRegistry is used by the package-level functions.
+var defaultRegistry = New()
+
 type Record struct {
 	Name       string
+	Version    string
 	Path       string
 	Properties map[string]interface{}
+
+	// The fields below are only set for products.  See product.Meta.
+	Description  string
+	Homepage     string
+	IaaS         []string
+	MinProtocol  uint
+	Dependencies []Dependency
 }
 
-func ListCloudConfigs() map[string]Record {
-	return cloudconfigs
+// Dependency names a product that must be deployed before the one whose
+// record lists it.  Version is a range as accepted by VersionInRange;
+// an empty range matches any version.
+type Dependency struct {
+	Name    string `yaml:"name" json:"name"`
+	Version string `yaml:"version" json:"version,omitempty"`
 }
 
-func ListProducts() map[string]Record {
-	return products
+// copy returns a copy of the record that shares no state with the original.
+func (r Record) copy() Record {
+	if r.Properties != nil {
+		props := make(map[string]interface{}, len(r.Properties))
+		for k, v := range r.Properties {
+			props[k] = v
+		}
+		r.Properties = props
+	}
+	if r.IaaS != nil {
+		r.IaaS = append([]string(nil), r.IaaS...)
+	}
+	if r.Dependencies != nil {
+		r.Dependencies = append([]Dependency(nil), r.Dependencies...)
+	}
+	return r
 }
 
-func RegisterProduct(pluginpath string) ([]pcli.Flag, error) {
-	client, productPlugin := GetProductReference(pluginpath)
-	defer client.Kill()
-	meta := productPlugin.GetMeta()
-	products[meta.Name] = Record{
-		Name:       meta.Name,
-		Path:       pluginpath,
-		Properties: meta.Properties,
+// Manifest describes a plugin in a YAML or JSON file shipped next to its
+// binary, so that the registry can read the plugin's metadata without
+// running it.  See ManifestExts.
+type Manifest struct {
+	Name    string `yaml:"name" json:"name"`
+	Version string `yaml:"version" json:"version"`
+	// Type is "product" or "cloudconfig".
+	Type string `yaml:"type" json:"type"`
+	// ProtocolVersions lists the plugin protocol versions the binary speaks.
+	ProtocolVersions []uint `yaml:"protocol_versions" json:"protocol_versions"`
+	// Checksum is the hex-encoded SHA-256 checksum of the binary,
+	// optionally prefixed with "sha256:".  It is checked when set.
+	Checksum string `yaml:"checksum" json:"checksum"`
+	// Description is stored in Record.Description for products and in
+	// the "description" property for cloud configs.
+	Description string                 `yaml:"description" json:"description"`
+	Properties  map[string]interface{} `yaml:"properties" json:"properties"`
+	// Homepage, IaaS, MinProtocol and Dependencies describe products and
+	// have the same meaning as in product.Meta.
+	Homepage     string       `yaml:"homepage" json:"homepage"`
+	IaaS         []string     `yaml:"iaas" json:"iaas"`
+	MinProtocol  uint         `yaml:"min_protocol" json:"min_protocol"`
+	Dependencies []Dependency `yaml:"dependencies" json:"dependencies"`
+	// Flags are returned when the plugin is registered.
+	Flags []pcli.Flag `yaml:"flags" json:"flags"`
+}
+
+// UseCache makes the registry consult c before starting a plugin process.
+// Passing nil disables caching.
+func (r *Registry) UseCache(c *Cache) {
+	r.mu.Lock()
+	r.cache = c
+	r.mu.Unlock()
+}
+
+// ListCloudConfigs returns a copy of the registered cloud config plugins, keyed by name.
+func (r *Registry) ListCloudConfigs() map[string]Record {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return copyRecords(r.cloudconfigs)
+}
+
+// ListProducts returns a copy of the registered product plugins, keyed by name.
+// When several versions of a product are registered, the latest is returned.
+func (r *Registry) ListProducts() map[string]Record {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	res := make(map[string]Record, len(r.products))
+	for name, versions := range r.products {
+		res[name] = latest(versions).copy()
 	}
-	return productPlugin.GetFlags(), nil
+	return res
 }
 
-func GetProductReference(pluginpath string) (*plugin.Client, product.Deployer) {
-	client := plugin.NewClient(&plugin.ClientConfig{
-		HandshakeConfig: product.HandshakeConfig,
-		Plugins: map[string]plugin.Plugin{
-			product.PluginsMapHash: new(product.Plugin),
-		},
-		Cmd: exec.Command(pluginpath, "plugin"),
-	})
-	rpcClient, err := client.Client()
+// ListProductVersions returns every registered version of the named
+// product, ordered from oldest to newest.
+func (r *Registry) ListProductVersions(name string) []Record {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	versions := r.products[name]
+	res := make([]Record, 0, len(versions))
+	for _, record := range versions {
+		res = append(res, record.copy())
+	}
+	sort.Sort(byVersion(res))
+	return res
+}
 
-	if err != nil {
-		lo.G.Debug("we got an error:", err)
-		log.Fatal(err)
+// GetProduct returns the named product at the requested version.
+// An empty version or "latest" selects the newest registered version.
+func (r *Registry) GetProduct(name, version string) (Record, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	versions, ok := r.products[name]
+	if !ok || len(versions) == 0 {
+		return Record{}, &NotFoundError{Name: name, Version: version}
 	}
-	raw, err := rpcClient.Dispense(product.PluginsMapHash)
+	if version == "" || version == Latest {
+		return latest(versions).copy(), nil
+	}
+	record, ok := versions[version]
+	if !ok {
+		return Record{}, &NotFoundError{Name: name, Version: version}
+	}
+	return record.copy(), nil
+}
 
-	if err != nil {
-		log.Fatal(err)
+// GetCloudConfig returns the named cloud config plugin.
+func (r *Registry) GetCloudConfig(name string) (Record, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	record, ok := r.cloudconfigs[name]
+	if !ok {
+		return Record{}, &NotFoundError{Name: name}
 	}
-	return client, raw.(product.Deployer)
+	return record.copy(), nil
 }
 
-func RegisterCloudConfig(pluginpath string) ([]pcli.Flag, error) {
-	client, ccPlugin := GetCloudConfigReference(pluginpath)
-	defer client.Kill()
-	meta := ccPlugin.GetMeta()
-	cloudconfigs[meta.Name] = Record{
-		Name:       meta.Name,
-		Path:       pluginpath,
-		Properties: meta.Properties,
+func latest(versions map[string]Record) Record {
+	var res Record
+	first := true
+	for _, record := range versions {
+		if first || compareVersions(record.Version, res.Version) > 0 {
+			res = record
+			first = false
+		}
 	}
-	return ccPlugin.GetFlags(), nil
+	return res
 }
 
-func GetCloudConfigReference(pluginpath string) (*plugin.Client, cloudconfig.Deployer) {
-	client := plugin.NewClient(&plugin.ClientConfig{
-		HandshakeConfig: cloudconfig.HandshakeConfig,
-		Plugins: map[string]plugin.Plugin{
-			cloudconfig.PluginsMapHash: new(cloudconfig.Plugin),
-		},
-		Cmd: exec.Command(pluginpath, "plugin"),
-	})
+func (r *Registry) addProduct(record Record) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	versions, ok := r.products[record.Name]
+	if !ok {
+		versions = make(map[string]Record)
+		r.products[record.Name] = versions
+	}
+	versions[record.Version] = record
+}
 
-	rpcClient, err := client.Client()
+func (r *Registry) addCloudConfig(record Record) {
+	r.mu.Lock()
+	r.cloudconfigs[record.Name] = record
+	r.mu.Unlock()
+}
 
+// rememberProtocol records the protocol version the plugin at pluginpath
+// speaks, so that the next start tries it first.  Zero is ignored.
+func (r *Registry) rememberProtocol(pluginpath string, version uint) {
+	if version == 0 {
+		return
+	}
+	r.mu.Lock()
+	r.versions[pluginpath] = version
+	r.mu.Unlock()
+}
+
+// protocolVersion returns the protocol version the plugin at pluginpath
+// last spoke, or zero if it is not known.
+func (r *Registry) protocolVersion(pluginpath string) uint {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.versions[pluginpath]
+}
+
+func copyRecords(records map[string]Record) map[string]Record {
+	res := make(map[string]Record, len(records))
+	for name, record := range records {
+		res[name] = record.copy()
+	}
+	return res
+}
+
+func (r *Registry) getCache() *Cache {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cache
+}
+
+// RegisterProduct starts the product plugin at pluginpath, adds it to
+// the registry and returns its flags.  If the plugin has a manifest,
+// the manifest is read instead of starting the plugin.
+func (r *Registry) RegisterProduct(pluginpath string) ([]pcli.Flag, error) {
+	_, flags, err := r.registerProduct(pluginpath, RegisterOptions{})
+	return flags, err
+}
+
+func (r *Registry) registerProduct(pluginpath string, opts RegisterOptions) (Record, []pcli.Flag, error) {
+	entry, ok := r.getCache().lookup(pluginpath, productType)
+	record, flags := entry.Record, entry.Flags
+	if ok {
+		if err := r.verify(pluginpath); err != nil {
+			return Record{}, nil, err
+		}
+		r.rememberProtocol(pluginpath, entry.Protocol)
+	} else {
+		var err error
+		if record, flags, err = r.loadProduct(pluginpath, opts); err != nil {
+			return Record{}, nil, err
+		}
+	}
+
+	r.addProduct(record)
+	r.notify(Event{Type: Registered, Record: record.copy()})
+	return record.copy(), flags, nil
+}
+
+// loadProduct reads the manifest of the product plugin at pluginpath.
+// Without a manifest it starts the plugin, reads its meta and flags,
+// and stores them in the cache.
+func (r *Registry) loadProduct(pluginpath string, opts RegisterOptions) (Record, []pcli.Flag, error) {
+	if m, ok, err := readManifest(pluginpath); ok || err != nil {
+		if err != nil {
+			return Record{}, nil, err
+		}
+		return r.manifestRecord(pluginpath, m, productType)
+	}
+
+	client, productPlugin, err := r.getProductReference(pluginpath, opts.StartTimeout)
 	if err != nil {
-		log.Fatal(err)
+		return Record{}, nil, err
+	}
+	defer r.release(pluginpath, client)
+	var (
+		meta  product.Meta
+		flags []pcli.Flag
+	)
+	var callErr error
+	err = callWithTimeout(opts.RPCTimeout, func() {
+		if meta, callErr = product.GetMetaE(productPlugin); callErr == nil {
+			flags, callErr = product.GetFlagsE(productPlugin)
+		}
+	})
+	if err == nil {
+		err = callErr
 	}
-	raw, err := rpcClient.Dispense(cloudconfig.PluginsMapHash)
+	if err != nil {
+		return Record{}, nil, &PluginError{Path: pluginpath, Kind: classifyCallErr(err), Err: err}
+	}
+	record := Record{
+		Name:         meta.Name,
+		Version:      meta.Version,
+		Path:         pluginpath,
+		Properties:   meta.Properties,
+		Description:  meta.Description,
+		Homepage:     meta.Homepage,
+		IaaS:         meta.IaaS,
+		MinProtocol:  meta.MinProtocol,
+		Dependencies: dependencies(meta.Dependencies),
+	}
+	if err = validateProduct(record); err != nil {
+		return Record{}, nil, &PluginError{Path: pluginpath, Kind: ErrMeta, Err: err}
+	}
+	if err = checkMinProtocol(pluginpath, record.MinProtocol); err != nil {
+		return Record{}, nil, err
+	}
+	r.getCache().store(pluginpath, productType, record, flags, r.protocolVersion(pluginpath))
+	return record, flags, nil
+}
 
+// RegisterCloudConfig starts the cloud config plugin at pluginpath, adds it
+// to the registry and returns its flags.  If the plugin has a manifest,
+// the manifest is read instead of starting the plugin.
+func (r *Registry) RegisterCloudConfig(pluginpath string) ([]pcli.Flag, error) {
+	_, flags, err := r.registerCloudConfig(pluginpath, RegisterOptions{})
+	return flags, err
+}
+
+func (r *Registry) registerCloudConfig(pluginpath string, opts RegisterOptions) (Record, []pcli.Flag, error) {
+	entry, ok := r.getCache().lookup(pluginpath, cloudConfigType)
+	record, flags := entry.Record, entry.Flags
+	if ok {
+		if err := r.verify(pluginpath); err != nil {
+			return Record{}, nil, err
+		}
+		r.rememberProtocol(pluginpath, entry.Protocol)
+	} else {
+		var err error
+		if record, flags, err = r.loadCloudConfig(pluginpath, opts); err != nil {
+			return Record{}, nil, err
+		}
+	}
+
+	r.addCloudConfig(record)
+	r.notify(Event{Type: Registered, Record: record.copy()})
+	return record.copy(), flags, nil
+}
+
+// loadCloudConfig reads the manifest of the cloud config plugin at
+// pluginpath.  Without a manifest it starts the plugin, reads its meta
+// and flags, and stores them in the cache.
+func (r *Registry) loadCloudConfig(pluginpath string, opts RegisterOptions) (Record, []pcli.Flag, error) {
+	if m, ok, err := readManifest(pluginpath); ok || err != nil {
+		if err != nil {
+			return Record{}, nil, err
+		}
+		return r.manifestRecord(pluginpath, m, cloudConfigType)
+	}
+
+	client, ccPlugin, err := r.getCloudConfigReference(pluginpath, opts.StartTimeout)
+	if err != nil {
+		return Record{}, nil, err
+	}
+	defer r.release(pluginpath, client)
+	var (
+		meta  cloudconfig.Meta
+		flags []pcli.Flag
+	)
+	var callErr error
+	err = callWithTimeout(opts.RPCTimeout, func() {
+		if meta, callErr = cloudconfig.GetMetaE(ccPlugin); callErr == nil {
+			flags, callErr = cloudconfig.GetFlagsE(ccPlugin)
+		}
+	})
+	if err == nil {
+		err = callErr
+	}
 	if err != nil {
-		log.Fatal(err)
+		return Record{}, nil, &PluginError{Path: pluginpath, Kind: classifyCallErr(err), Err: err}
 	}
-	return client, raw.(cloudconfig.Deployer)
+	record := Record{
+		Name:       meta.Name,
+		Path:       pluginpath,
+		Properties: meta.Properties,
+	}
+	r.getCache().store(pluginpath, cloudConfigType, record, flags, r.protocolVersion(pluginpath))
+	return record, flags, nil
+}
+
+// UseCache sets the cache used by the default registry.
+func UseCache(c *Cache) {
+	defaultRegistry.UseCache(c)
+}
+
+// ListCloudConfigs returns the cloud config plugins in the default registry.
+func ListCloudConfigs() map[string]Record {
+	return defaultRegistry.ListCloudConfigs()
+}
+
+// ListProducts returns the product plugins in the default registry.
+func ListProducts() map[string]Record {
+	return defaultRegistry.ListProducts()
+}
+
+// ListProductVersions returns every version of the named product in the default registry.
+func ListProductVersions(name string) []Record {
+	return defaultRegistry.ListProductVersions(name)
+}
+
+// GetProduct returns the named product at the requested version from the default registry.
+func GetProduct(name, version string) (Record, error) {
+	return defaultRegistry.GetProduct(name, version)
+}
+
+// GetCloudConfig returns the named cloud config plugin from the default registry.
+func GetCloudConfig(name string) (Record, error) {
+	return defaultRegistry.GetCloudConfig(name)
+}
+
+// RegisterProduct adds the product plugin at pluginpath to the default registry.
+func RegisterProduct(pluginpath string) ([]pcli.Flag, error) {
+	return defaultRegistry.RegisterProduct(pluginpath)
+}
+
+// RegisterCloudConfig adds the cloud config plugin at pluginpath to the default registry.
+func RegisterCloudConfig(pluginpath string) ([]pcli.Flag, error) {
+	return defaultRegistry.RegisterCloudConfig(pluginpath)
 }
@@ -1,9 +1,17 @@
 package registry_test
 
 import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"runtime"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/enaml-ops/pluginlib/cred"
+	productv2 "github.com/enaml-ops/pluginlib/productv2"
 	. "github.com/enaml-ops/pluginlib/registry"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -26,6 +34,35 @@ var _ = Describe("Registry", func() {
 				Ω(len(products)).Should(Equal(1))
 				Ω(products["myfakeproduct"]).ShouldNot(BeNil())
 			})
+
+			It("then it should index the plugin's metadata", func() {
+				record := ListProducts()["myfakeproduct"]
+				Ω(record.Description).Should(Equal("a product for testing plugins"))
+				Ω(record.Homepage).Should(Equal("https://github.com/enaml-ops/pluginlib"))
+				Ω(record.IaaS).Should(Equal([]string{"aws", "vsphere"}))
+				Ω(record.Dependencies).Should(Equal([]Dependency{{Name: "cf", Version: ">=1.0.0"}}))
+				Ω(FindProducts(SupportsIaaS("gcp"))).Should(BeEmpty())
+				Ω(FindProducts(DependsOn("cf"))).Should(HaveLen(1))
+			})
+		})
+
+		Context("when called w/ a path that does not exist", func() {
+			It("then it should return a missing binary error", func() {
+				_, err := RegisterProduct("./fixtures/product/does-not-exist")
+				Ω(err).Should(HaveOccurred())
+				Ω(IsPluginError(err, ErrMissingBinary)).Should(BeTrue())
+				Ω(err.(*PluginError).Path).Should(Equal("./fixtures/product/does-not-exist"))
+			})
+		})
+
+		Context("when called w/ a cloud config plugin", func() {
+			It("then it should return a dispense error", func() {
+				if testing.Short() {
+					Skip("plugin registry tests skipped in short mode")
+				}
+				_, err := RegisterProduct("./fixtures/cloudconfig/testplugin-" + runtime.GOOS)
+				Ω(IsPluginError(err, ErrDispense)).Should(BeTrue())
+			})
 		})
 	})
 	Describe("given RegisterCloudConfig function", func() {
@@ -44,5 +81,176 @@ var _ = Describe("Registry", func() {
 				Ω(cloudconfigs["myfakecloudconfig"]).ShouldNot(BeNil())
 			})
 		})
+
+		Context("when called w/ a path that does not exist", func() {
+			It("then it should return a missing binary error", func() {
+				_, err := RegisterCloudConfig("./fixtures/cloudconfig/does-not-exist")
+				Ω(IsPluginError(err, ErrMissingBinary)).Should(BeTrue())
+			})
+		})
+	})
+})
+
+var _ = Describe("given a Registry created with New", func() {
+	const pluginpath = "./fixtures/product/testproductplugin-" + runtime.GOOS
+
+	BeforeEach(func() {
+		if testing.Short() {
+			Skip("plugin registry tests skipped in short mode")
+		}
+	})
+
+	It("then it should not share state with other registries", func() {
+		reg := New()
+		_, err := reg.RegisterProduct(pluginpath)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(reg.ListProducts()).Should(HaveKey("myfakeproduct"))
+		Ω(New().ListProducts()).Should(BeEmpty())
+	})
+
+	It("then it should return a copy of its products", func() {
+		reg := New()
+		_, err := reg.RegisterProduct(pluginpath)
+		Ω(err).ShouldNot(HaveOccurred())
+		products := reg.ListProducts()
+		delete(products, "myfakeproduct")
+		Ω(reg.ListProducts()).Should(HaveKey("myfakeproduct"))
+	})
+
+	It("then it should allow plugins to be registered concurrently", func() {
+		reg := New()
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				defer GinkgoRecover()
+				_, err := reg.RegisterProduct(pluginpath)
+				Ω(err).ShouldNot(HaveOccurred())
+			}()
+			go func() {
+				defer wg.Done()
+				reg.ListProducts()
+			}()
+		}
+		wg.Wait()
+		Ω(reg.ListProducts()).Should(HaveLen(1))
+	})
+})
+
+var _ = Describe("given a product that uses the host's cred store", func() {
+	var dir string
+
+	BeforeEach(func() {
+		if testing.Short() {
+			Skip("plugin registry tests skipped in short mode")
+		}
+		var err error
+		dir, err = ioutil.TempDir("", "registry-cred")
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(ioutil.WriteFile(filepath.Join(dir, "myfakeproduct"), []byte("{}"), 0644)).Should(Succeed())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("then secrets the plugin generates should be written to the host's store", func() {
+		client, p, err := New().GetProductReference("./fixtures/product/testproductplugin-" + runtime.GOOS)
+		Ω(err).ShouldNot(HaveOccurred())
+		defer client.Kill()
+
+		store := cred.NewFileStore(dir)
+		b, err := p.GetProduct(nil, nil, store)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(string(b)).Should(Equal("password: generated-password"))
+		Ω(store.Get("myfakeproduct", "password")).Should(Equal("generated-password"))
+
+		Ω(store.Post("myfakeproduct", "password", "from-the-host")).Should(Succeed())
+		b, err = p.GetProduct(nil, nil, store)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(string(b)).Should(Equal("password: from-the-host"))
+	})
+
+	It("then a dry run should report the secrets without writing them", func() {
+		client, p, err := New().GetProductReferenceV2("./fixtures/product/testproductplugin-" + runtime.GOOS)
+		Ω(err).ShouldNot(HaveOccurred())
+		defer client.Kill()
+
+		store := cred.NewFileStore(dir)
+		res, err := productv2.DryRun(context.Background(), p, nil, nil, store)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(string(res.Manifest.Bytes())).ShouldNot(BeEmpty())
+		// the plugin's output is not a manifest enaml can fully model
+		Ω(string(res.Raw)).Should(Equal("password: generated-password"))
+		Ω(res.Writes).Should(Equal([]cred.Write{{Path: "myfakeproduct", Key: "password", Value: "generated-password"}}))
+		_, err = store.Get("myfakeproduct", "password")
+		Ω(err).Should(HaveOccurred())
+	})
+})
+
+var _ = Describe("given a V2 product plugin", func() {
+	const v2plugin = "./fixtures/productv2/testproductplugin-"
+
+	BeforeEach(func() {
+		if testing.Short() {
+			Skip("plugin registry tests skipped in short mode")
+		}
+	})
+
+	It("then it should be registered alongside V1 plugins", func() {
+		reg := New()
+		_, err := reg.RegisterProduct(v2plugin + runtime.GOOS)
+		Ω(err).ShouldNot(HaveOccurred())
+		_, err = reg.RegisterProduct("./fixtures/product/testproductplugin-" + runtime.GOOS)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		record, err := reg.GetProduct("myfakeproductv2", Latest)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(record.Version).Should(Equal("2.0.0"))
+		Ω(reg.ListProducts()).Should(HaveKey("myfakeproduct"))
+	})
+
+	It("then its calls should time out with their context", func() {
+		client, p, err := New().GetProductReferenceV2(v2plugin + runtime.GOOS)
+		Ω(err).ShouldNot(HaveOccurred())
+		defer client.Kill()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		_, err = p.GetProduct(ctx, []string{"--hang"}, nil, nil)
+		Ω(err).Should(Equal(context.DeadlineExceeded))
+
+		b, err := p.GetProduct(context.Background(), nil, nil, nil)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(string(b)).Should(ContainSubstring("name: myfakeproductv2"))
+	})
+
+	It("then its typed manifest should be available", func() {
+		client, p, err := New().GetProductReferenceV2(v2plugin + runtime.GOOS)
+		Ω(err).ShouldNot(HaveOccurred())
+		defer client.Kill()
+
+		m, err := productv2.GetManifest(context.Background(), p, nil, nil, nil)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(m.Deployment.Name).Should(Equal("myfakeproductv2"))
+		Ω(m.Releases).Should(HaveLen(1))
+		Ω(m.Warnings).Should(ConsistOf("this product deploys nothing"))
+	})
+
+	It("then V1 plugins should be usable through the V2 interface", func() {
+		client, p, err := New().GetProductReferenceV2("./fixtures/product/testproductplugin-" + runtime.GOOS)
+		Ω(err).ShouldNot(HaveOccurred())
+		defer client.Kill()
+		meta, err := p.GetMeta(context.Background())
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(meta.Name).Should(Equal("myfakeproduct"))
+	})
+
+	It("then the V1 interface should work for V2 plugins", func() {
+		client, p, err := New().GetProductReference(v2plugin + runtime.GOOS)
+		Ω(err).ShouldNot(HaveOccurred())
+		defer client.Kill()
+		Ω(p.GetMeta().Name).Should(Equal("myfakeproductv2"))
 	})
 })
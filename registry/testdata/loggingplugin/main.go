@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/enaml-ops/pluginlib/cred"
+	"github.com/enaml-ops/pluginlib/pcli"
+	"github.com/enaml-ops/pluginlib/productv1"
+)
+
+// a product plugin for the registry's logging tests
+func main() {
+	product.Run(new(loggingProduct))
+}
+
+type loggingProduct struct{}
+
+func (s *loggingProduct) GetFlags() (flags []pcli.Flag) {
+	return
+}
+
+// GetMeta logs a whole line and then output without a trailing newline,
+// which the host should log once the plugin exits.
+func (s *loggingProduct) GetMeta() product.Meta {
+	log.Println("GetMeta called")
+	fmt.Print("partial line")
+	return product.Meta{
+		Name:    "loggingproduct",
+		Version: "1.0.0",
+	}
+}
+
+func (s *loggingProduct) GetProduct(args []string, cloudconfig []byte, cs cred.Store) ([]byte, error) {
+	return []byte(""), nil
+}
@@ -0,0 +1,196 @@
+package registry
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SignatureExt is appended to a plugin's path to find its detached signature.
+const SignatureExt = ".sig"
+
+// Verifier checks a plugin binary before the registry executes it.
+type Verifier interface {
+	// Verify returns an error if the plugin at pluginpath must not be run.
+	// Before a plugin is started it is passed a private copy of the
+	// binary, which is what then runs.
+	Verify(pluginpath string) error
+}
+
+// UseVerifier makes the registry refuse to start any plugin that v
+// does not accept.  Passing nil disables verification.
+func (r *Registry) UseVerifier(v Verifier) {
+	r.mu.Lock()
+	r.verifier = v
+	r.mu.Unlock()
+}
+
+// UseVerifier sets the verifier used by the default registry.
+func UseVerifier(v Verifier) {
+	defaultRegistry.UseVerifier(v)
+}
+
+func (r *Registry) verify(pluginpath string) error {
+	r.mu.RLock()
+	v := r.verifier
+	r.mu.RUnlock()
+	if v == nil {
+		return nil
+	}
+	if err := v.Verify(pluginpath); err != nil {
+		return &PluginError{Path: pluginpath, Kind: ErrVerification, Err: err}
+	}
+	return nil
+}
+
+// verifiedCopy copies the plugin at pluginpath, and its signature if there
+// is one, into a private directory and verifies the copy, so that the
+// binary cannot be replaced between being verified and being run.  It
+// returns the path to run and a function that removes the copy, which may
+// be called as soon as the plugin has started.  Without a verifier the
+// plugin is run in place.
+func (r *Registry) verifiedCopy(pluginpath string) (string, func(), error) {
+	r.mu.RLock()
+	v := r.verifier
+	r.mu.RUnlock()
+	if v == nil {
+		return pluginpath, func() {}, nil
+	}
+
+	dir, err := ioutil.TempDir("", "enaml-plugin")
+	if err != nil {
+		return "", nil, &PluginError{Path: pluginpath, Kind: ErrStartup, Err: err}
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+	exe := filepath.Join(dir, filepath.Base(pluginpath))
+	if err := copyFile(exe, pluginpath, 0700); err != nil {
+		cleanup()
+		return "", nil, &PluginError{Path: pluginpath, Kind: ErrMissingBinary, Err: err}
+	}
+	err = copyFile(exe+SignatureExt, pluginpath+SignatureExt, 0600)
+	if err != nil && !os.IsNotExist(err) {
+		cleanup()
+		return "", nil, &PluginError{Path: pluginpath, Kind: ErrVerification, Err: err}
+	}
+	if err := v.Verify(exe); err != nil {
+		cleanup()
+		return "", nil, &PluginError{Path: pluginpath, Kind: ErrVerification, Err: err}
+	}
+	return exe, cleanup, nil
+}
+
+func copyFile(dst, src string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+type checksumVerifier map[string]bool
+
+// ChecksumVerifier accepts only plugin binaries whose hex-encoded
+// SHA-256 checksum is one of sums.
+func ChecksumVerifier(sums ...string) Verifier {
+	v := make(checksumVerifier, len(sums))
+	for _, sum := range sums {
+		v[strings.ToLower(strings.TrimSpace(sum))] = true
+	}
+	return v
+}
+
+func (v checksumVerifier) Verify(pluginpath string) error {
+	_, sum, err := checksum(pluginpath)
+	if err != nil {
+		return err
+	}
+	if !v[sum] {
+		return fmt.Errorf("checksum %s is not in the list of trusted plugins", sum)
+	}
+	return nil
+}
+
+type signatureVerifier []ed25519.PublicKey
+
+// SignatureVerifier accepts only plugin binaries that have a detached
+// ed25519 signature from one of the trusted keys.  The signature is read
+// from the plugin's path plus SignatureExt, either raw or base64 encoded,
+// and covers the SHA-256 digest of the binary.  See SignPlugin.
+func SignatureVerifier(keys ...ed25519.PublicKey) Verifier {
+	return signatureVerifier(keys)
+}
+
+func (v signatureVerifier) Verify(pluginpath string) error {
+	sig, err := readSignature(pluginpath + SignatureExt)
+	if err != nil {
+		return err
+	}
+	digest, err := digest(pluginpath)
+	if err != nil {
+		return err
+	}
+	for _, key := range v {
+		if len(key) == ed25519.PublicKeySize && ed25519.Verify(key, digest, sig) {
+			return nil
+		}
+	}
+	return errors.New("signature is not from a trusted key")
+}
+
+// SignPlugin writes a detached signature for the plugin at pluginpath
+// that SignatureVerifier will accept for the matching public key.
+func SignPlugin(pluginpath string, key ed25519.PrivateKey) error {
+	digest, err := digest(pluginpath)
+	if err != nil {
+		return err
+	}
+	sig := base64.StdEncoding.EncodeToString(ed25519.Sign(key, digest))
+	return ioutil.WriteFile(pluginpath+SignatureExt, []byte(sig+"\n"), 0644)
+}
+
+func readSignature(name string) ([]byte, error) {
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("missing signature: %v", err)
+	}
+	if len(b) == ed25519.SignatureSize {
+		return b, nil
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(b)))
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return nil, fmt.Errorf("malformed signature in %s", name)
+	}
+	return sig, nil
+}
+
+func digest(name string) ([]byte, error) {
+	_, sum, err := checksum(name)
+	if err != nil {
+		return nil, err
+	}
+	b, err := hex.DecodeString(sum)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) != sha256.Size {
+		return nil, fmt.Errorf("unexpected digest length %d", len(b))
+	}
+	return b, nil
+}
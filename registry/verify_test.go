@@ -0,0 +1,137 @@
+package registry_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	. "github.com/enaml-ops/pluginlib/registry"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("plugin verification", func() {
+	var (
+		reg        *Registry
+		dir        string
+		pluginpath string
+	)
+
+	BeforeEach(func() {
+		if testing.Short() {
+			Skip("plugin registry tests skipped in short mode")
+		}
+		reg = New()
+
+		var err error
+		dir, err = ioutil.TempDir("", "registry-verify")
+		Ω(err).ShouldNot(HaveOccurred())
+		b, err := ioutil.ReadFile("./fixtures/product/testproductplugin-" + runtime.GOOS)
+		Ω(err).ShouldNot(HaveOccurred())
+		pluginpath = filepath.Join(dir, "testproductplugin")
+		Ω(ioutil.WriteFile(pluginpath, b, 0755)).Should(Succeed())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	sha256Of := func(name string) string {
+		b, err := ioutil.ReadFile(name)
+		Ω(err).ShouldNot(HaveOccurred())
+		sum := sha256.Sum256(b)
+		return hex.EncodeToString(sum[:])
+	}
+
+	Context("when the plugin is replaced after it has been verified", func() {
+		It("then it should still run the binary that was verified", func() {
+			reg.UseVerifier(replacingVerifier{
+				Verifier: ChecksumVerifier(sha256Of(pluginpath)),
+				target:   pluginpath,
+			})
+			_, err := reg.RegisterProduct(pluginpath)
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+	})
+
+	Context("when using a ChecksumVerifier", func() {
+		It("then it should start plugins with a pinned checksum", func() {
+			reg.UseVerifier(ChecksumVerifier(sha256Of(pluginpath)))
+			_, err := reg.RegisterProduct(pluginpath)
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("then it should refuse plugins without a pinned checksum", func() {
+			reg.UseVerifier(ChecksumVerifier("0000"))
+			_, err := reg.RegisterProduct(pluginpath)
+			Ω(IsPluginError(err, ErrVerification)).Should(BeTrue())
+			Ω(reg.ListProducts()).Should(BeEmpty())
+
+			_, _, err = reg.GetProductReference(pluginpath)
+			Ω(IsPluginError(err, ErrVerification)).Should(BeTrue())
+		})
+	})
+
+	Context("when using a SignatureVerifier", func() {
+		var (
+			pub  ed25519.PublicKey
+			priv ed25519.PrivateKey
+		)
+
+		BeforeEach(func() {
+			var err error
+			pub, priv, err = ed25519.GenerateKey(rand.Reader)
+			Ω(err).ShouldNot(HaveOccurred())
+			reg.UseVerifier(SignatureVerifier(pub))
+		})
+
+		It("then it should start plugins signed by a trusted key", func() {
+			Ω(SignPlugin(pluginpath, priv)).Should(Succeed())
+			_, err := reg.RegisterProduct(pluginpath)
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("then it should refuse plugins without a signature", func() {
+			_, err := reg.RegisterProduct(pluginpath)
+			Ω(IsPluginError(err, ErrVerification)).Should(BeTrue())
+		})
+
+		It("then it should refuse plugins signed by an untrusted key", func() {
+			_, other, err := ed25519.GenerateKey(rand.Reader)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(SignPlugin(pluginpath, other)).Should(Succeed())
+			_, err = reg.RegisterProduct(pluginpath)
+			Ω(IsPluginError(err, ErrVerification)).Should(BeTrue())
+		})
+
+		It("then it should refuse plugins modified after signing", func() {
+			Ω(SignPlugin(pluginpath, priv)).Should(Succeed())
+			f, err := os.OpenFile(pluginpath, os.O_APPEND|os.O_WRONLY, 0755)
+			Ω(err).ShouldNot(HaveOccurred())
+			f.Write([]byte{0})
+			f.Close()
+			_, err = reg.RegisterProduct(pluginpath)
+			Ω(IsPluginError(err, ErrVerification)).Should(BeTrue())
+		})
+	})
+})
+
+// replacingVerifier overwrites target with a script that is not a plugin
+// once the wrapped Verifier has accepted the binary it was given.
+type replacingVerifier struct {
+	Verifier
+	target string
+}
+
+func (v replacingVerifier) Verify(pluginpath string) error {
+	if err := v.Verifier.Verify(pluginpath); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(v.target, []byte("#!/bin/sh\nexit 1\n"), 0755)
+}
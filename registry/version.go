@@ -0,0 +1,265 @@
+package registry
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Latest can be passed as a version to select the newest registered version.
+const Latest = "latest"
+
+// version is a parsed semantic version.
+type version struct {
+	parts [3]int
+	pre   string
+}
+
+// parseVersion parses a semantic version such as "1.2.3", "v1.2" or
+// "2.0.0-rc.1". Build metadata is ignored.
+func parseVersion(s string) (version, bool) {
+	var v version
+	s = strings.TrimPrefix(s, "v")
+	if i := strings.Index(s, "+"); i != -1 {
+		s = s[:i]
+	}
+	if i := strings.Index(s, "-"); i != -1 {
+		v.pre = s[i+1:]
+		s = s[:i]
+	}
+	fields := strings.Split(s, ".")
+	if len(fields) > 3 {
+		return version{}, false
+	}
+	for i, field := range fields {
+		n, err := strconv.Atoi(field)
+		if err != nil || n < 0 {
+			return version{}, false
+		}
+		v.parts[i] = n
+	}
+	return v, true
+}
+
+func (v version) compare(o version) int {
+	for i := range v.parts {
+		if v.parts[i] != o.parts[i] {
+			if v.parts[i] < o.parts[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case v.pre == o.pre:
+		return 0
+	case v.pre == "":
+		return 1
+	case o.pre == "":
+		return -1
+	}
+	return comparePre(v.pre, o.pre)
+}
+
+// comparePre compares pre-release tags by their dot separated
+// identifiers.  Numeric identifiers are compared as numbers and sort
+// before alphanumeric ones, and a shorter tag sorts before a longer one
+// it is a prefix of.
+func comparePre(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		an, aerr := strconv.ParseUint(as[i], 10, 64)
+		bn, berr := strconv.ParseUint(bs[i], 10, 64)
+		switch {
+		case aerr == nil && berr == nil:
+			if an != bn {
+				if an < bn {
+					return -1
+				}
+				return 1
+			}
+		case aerr == nil:
+			return -1
+		case berr == nil:
+			return 1
+		default:
+			if c := strings.Compare(as[i], bs[i]); c != 0 {
+				return c
+			}
+		}
+	}
+	switch {
+	case len(as) < len(bs):
+		return -1
+	case len(as) > len(bs):
+		return 1
+	}
+	return 0
+}
+
+// compareVersions compares two version strings, returning -1, 0 or 1.
+// Versions that are not semantic versions sort before those that are,
+// and are compared as plain strings.
+func compareVersions(a, b string) int {
+	va, aok := parseVersion(a)
+	vb, bok := parseVersion(b)
+	switch {
+	case aok && bok:
+		return va.compare(vb)
+	case aok:
+		return 1
+	case bok:
+		return -1
+	}
+	return strings.Compare(a, b)
+}
+
+type byVersion []Record
+
+func (s byVersion) Len() int           { return len(s) }
+func (s byVersion) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byVersion) Less(i, j int) bool { return compareVersions(s[i].Version, s[j].Version) < 0 }
+
+// versionRange is a set of alternatives, any of which may match.
+// Each alternative is a set of comparators that must all match.
+type versionRange [][]comparator
+
+type comparator struct {
+	op string
+	v  version
+}
+
+// parseRange parses a version range such as ">=1.2.0 <2.0.0",
+// "~1.4", "^2.1.0" or "1.x || >=3.0.0".
+// Comparators separated by spaces or commas must all match, and
+// alternatives are separated by "||".
+func parseRange(s string) (versionRange, error) {
+	var rng versionRange
+	for _, alt := range strings.Split(s, "||") {
+		fields := strings.FieldsFunc(alt, func(r rune) bool { return r == ' ' || r == ',' })
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("registry: invalid version range %q", s)
+		}
+		var cmps []comparator
+		for _, field := range fields {
+			c, err := parseComparator(field)
+			if err != nil {
+				return nil, fmt.Errorf("registry: invalid version range %q: %v", s, err)
+			}
+			cmps = append(cmps, c...)
+		}
+		rng = append(rng, cmps)
+	}
+	return rng, nil
+}
+
+func parseComparator(s string) ([]comparator, error) {
+	op := ""
+	for _, prefix := range []string{">=", "<=", "!=", ">", "<", "=", "~", "^"} {
+		if strings.HasPrefix(s, prefix) {
+			op = prefix
+			break
+		}
+	}
+	s = strings.TrimPrefix(s, op)
+
+	// wildcards such as 1.x or 1.2.* become tilde or caret ranges
+	fields := strings.Split(strings.TrimPrefix(s, "v"), ".")
+	for i, field := range fields {
+		if field == "x" || field == "X" || field == "*" {
+			if op != "" && op != "=" {
+				return nil, fmt.Errorf("wildcard %q cannot be used with %s", s, op)
+			}
+			if i == 0 {
+				return []comparator{{op: ">=", v: version{}}}, nil
+			}
+			s = strings.Join(fields[:i], ".")
+			if i == 1 {
+				op = "^"
+			} else {
+				op = "~"
+			}
+			break
+		}
+	}
+
+	v, ok := parseVersion(s)
+	if !ok {
+		return nil, fmt.Errorf("%q is not a version", s)
+	}
+	switch op {
+	case "~":
+		// ~1 allows any 1.x.x, ~1.2 and ~1.2.3 any 1.2.x
+		if given(s) == 1 {
+			return []comparator{{">=", v}, {"<", v.bump(0)}}, nil
+		}
+		return []comparator{{">=", v}, {"<", v.bump(1)}}, nil
+	case "^":
+		// ^ allows changes that do not modify the first non-zero part
+		// given, so ^1.2.3 allows 1.x.x, ^0.2.3 0.2.x and ^0.0.3 only 0.0.3
+		i := 0
+		for i < given(s)-1 && v.parts[i] == 0 {
+			i++
+		}
+		return []comparator{{">=", v}, {"<", v.bump(i)}}, nil
+	case "":
+		op = "="
+	}
+	return []comparator{{op, v}}, nil
+}
+
+// given returns the number of parts in the version s.
+func given(s string) int {
+	s = strings.TrimPrefix(s, "v")
+	if i := strings.IndexAny(s, "-+"); i != -1 {
+		s = s[:i]
+	}
+	return len(strings.Split(s, "."))
+}
+
+// bump returns the release version with part i incremented and the parts
+// after it zeroed.
+func (v version) bump(i int) version {
+	var res version
+	copy(res.parts[:i], v.parts[:i])
+	res.parts[i] = v.parts[i] + 1
+	return res
+}
+
+func (c comparator) match(v version) bool {
+	cmp := v.compare(c.v)
+	switch c.op {
+	case "=":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	case "<":
+		return cmp < 0
+	}
+	return cmp <= 0
+}
+
+// contains reports whether s is a version within the range.
+func (rng versionRange) contains(s string) bool {
+	v, ok := parseVersion(s)
+	if !ok {
+		return false
+	}
+	for _, alt := range rng {
+		matched := true
+		for _, c := range alt {
+			if !c.match(v) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,127 @@
+package registry
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("product versions", func() {
+	Describe("compareVersions", func() {
+		It("orders semantic versions numerically", func() {
+			Ω(compareVersions("1.10.0", "1.9.0")).Should(Equal(1))
+			Ω(compareVersions("v1.2", "1.2.0")).Should(Equal(0))
+			Ω(compareVersions("1.2.3", "2.0.0")).Should(Equal(-1))
+		})
+
+		It("orders pre-releases before releases", func() {
+			Ω(compareVersions("2.0.0-rc.1", "2.0.0")).Should(Equal(-1))
+			Ω(compareVersions("2.0.0-rc.2", "2.0.0-rc.1")).Should(Equal(1))
+		})
+
+		It("orders pre-release identifiers as semver does", func() {
+			Ω(compareVersions("1.0.0-alpha.10", "1.0.0-alpha.2")).Should(Equal(1))
+			Ω(compareVersions("1.0.0-rc.9", "1.0.0-rc.10")).Should(Equal(-1))
+			Ω(compareVersions("1.0.0-alpha", "1.0.0-alpha.1")).Should(Equal(-1))
+			Ω(compareVersions("1.0.0-alpha.1", "1.0.0-alpha.beta")).Should(Equal(-1))
+			Ω(compareVersions("1.0.0-beta", "1.0.0-alpha.beta")).Should(Equal(1))
+			Ω(compareVersions("1.0.0-rc.1", "1.0.0-rc.1")).Should(Equal(0))
+		})
+
+		It("orders non-semantic versions before semantic ones", func() {
+			Ω(compareVersions("", "0.0.1")).Should(Equal(-1))
+			Ω(compareVersions("nightly", "1.0.0")).Should(Equal(-1))
+		})
+	})
+
+	Describe("parseRange", func() {
+		It("expands tilde and caret ranges", func() {
+			for rng, bounds := range map[string][2]string{
+				"~1":     {"1.0.0", "2.0.0"},
+				"~1.2":   {"1.2.0", "1.3.0"},
+				"~1.2.3": {"1.2.3", "1.3.0"},
+				"~0":     {"0.0.0", "1.0.0"},
+				"~0.2.3": {"0.2.3", "0.3.0"},
+				"^1":     {"1.0.0", "2.0.0"},
+				"^1.2":   {"1.2.0", "2.0.0"},
+				"^1.2.3": {"1.2.3", "2.0.0"},
+				"^0":     {"0.0.0", "1.0.0"},
+				"^0.2":   {"0.2.0", "0.3.0"},
+				"^0.2.3": {"0.2.3", "0.3.0"},
+				"^0.0":   {"0.0.0", "0.1.0"},
+				"^0.0.3": {"0.0.3", "0.0.4"},
+				"1.x":    {"1.0.0", "2.0.0"},
+				"1.2.x":  {"1.2.0", "1.3.0"},
+				"0.x":    {"0.0.0", "1.0.0"},
+			} {
+				r, err := parseRange(rng)
+				Ω(err).ShouldNot(HaveOccurred(), rng)
+				lower, _ := parseVersion(bounds[0])
+				upper, _ := parseVersion(bounds[1])
+				Ω(r).Should(Equal(versionRange{{{">=", lower}, {"<", upper}}}), rng)
+			}
+		})
+
+		It("matches versions within a caret range with a zero major", func() {
+			r, err := parseRange("^0.2.3")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(r.contains("0.2.9")).Should(BeTrue())
+			Ω(r.contains("0.3.0")).Should(BeFalse())
+			Ω(r.contains("0.2.2")).Should(BeFalse())
+		})
+	})
+
+	Context("when several versions of a product are registered", func() {
+		var reg *Registry
+
+		BeforeEach(func() {
+			reg = New()
+			reg.addProduct(Record{Name: "p-mysql", Version: "1.9.0", Path: "/plugins/p-mysql-1.9.0"})
+			reg.addProduct(Record{Name: "p-mysql", Version: "1.10.0", Path: "/plugins/p-mysql-1.10.0"})
+			reg.addProduct(Record{Name: "p-mysql", Version: "1.10.0-rc.1", Path: "/plugins/p-mysql-1.10.0-rc.1"})
+		})
+
+		It("then it should keep every version", func() {
+			versions := reg.ListProductVersions("p-mysql")
+			Ω(versions).Should(HaveLen(3))
+			Ω(versions[0].Version).Should(Equal("1.9.0"))
+			Ω(versions[1].Version).Should(Equal("1.10.0-rc.1"))
+			Ω(versions[2].Version).Should(Equal("1.10.0"))
+		})
+
+		It("then it should list the latest version", func() {
+			Ω(reg.ListProducts()["p-mysql"].Version).Should(Equal("1.10.0"))
+		})
+
+		It("then it should resolve the latest version", func() {
+			record, err := reg.GetProduct("p-mysql", Latest)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(record.Path).Should(Equal("/plugins/p-mysql-1.10.0"))
+
+			record, err = reg.GetProduct("p-mysql", "")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(record.Version).Should(Equal("1.10.0"))
+		})
+
+		It("then it should resolve the latest pre-release", func() {
+			reg.addProduct(Record{Name: "p-redis", Version: "2.0.0-rc.9", Path: "/plugins/p-redis-2.0.0-rc.9"})
+			reg.addProduct(Record{Name: "p-redis", Version: "2.0.0-rc.10", Path: "/plugins/p-redis-2.0.0-rc.10"})
+			record, err := reg.GetProduct("p-redis", Latest)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(record.Version).Should(Equal("2.0.0-rc.10"))
+		})
+
+		It("then it should resolve a specific version", func() {
+			record, err := reg.GetProduct("p-mysql", "1.9.0")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(record.Path).Should(Equal("/plugins/p-mysql-1.9.0"))
+		})
+
+		It("then it should return an error for an unknown version or product", func() {
+			_, err := reg.GetProduct("p-mysql", "2.0.0")
+			Ω(err).Should(BeAssignableToTypeOf(&NotFoundError{}))
+
+			_, err = reg.GetProduct("p-redis", Latest)
+			Ω(err).Should(BeAssignableToTypeOf(&NotFoundError{}))
+		})
+	})
+})